@@ -0,0 +1,139 @@
+// Package capture reads and writes captures of raw telegrams with the time they were received, so they can be replayed
+// later to reproduce bugs or to backfill data.
+//
+// A capture consists of records. Each record starts with a header line containing the receive time in RFC 3339 format
+// with nanoseconds and the length of the telegram in bytes, followed by the raw telegram and a newline:
+//
+//	# 2023-10-29T01:30:00.123456789Z 812
+//	/ISK5\2M550T-1012
+//	...
+//	!A1B2
+//
+// Captures may be compressed with gzip, which is detected when reading.
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTelegramSize is the maximum size of a telegram in a capture, which protects against allocating huge buffers when
+// reading a corrupt capture.
+const maxTelegramSize = 1024 * 1024
+
+// Record is a telegram and the time it was received.
+type Record struct {
+	Time     time.Time
+	Telegram []byte
+}
+
+// Writer writes records to a capture.
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w: w,
+	}
+}
+
+// Write writes a record for the telegram received at t. The record is written with a single call to the underlying
+// writer.
+func (w *Writer) Write(t time.Time, telegram []byte) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s %d\n", t.UTC().Format(time.RFC3339Nano), len(telegram))
+	buf.Write(telegram)
+	buf.WriteByte('\n')
+
+	if _, err := w.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+
+	return nil
+}
+
+// Reader reads records from a capture.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a reader of the capture in r, which is decompressed if it was compressed with gzip.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		br = bufio.NewReader(gr)
+	}
+
+	return &Reader{
+		r: br,
+	}, nil
+}
+
+// Next reads the next record. When the capture is exhausted, io.EOF is returned.
+func (r *Reader) Next() (Record, error) {
+	header, err := r.r.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) && header == "" {
+			return Record{}, io.EOF
+		}
+		return Record{}, fmt.Errorf("failed to read record header: %w", unexpectedEOF(err))
+	}
+
+	t, length, err := parseHeader(strings.TrimRight(header, "\r\n"))
+	if err != nil {
+		return Record{}, err
+	}
+
+	telegram := make([]byte, length+1)
+	if _, err := io.ReadFull(r.r, telegram); err != nil {
+		return Record{}, fmt.Errorf("failed to read telegram: %w", unexpectedEOF(err))
+	}
+	if telegram[length] != '\n' {
+		return Record{}, errors.New("telegram is not followed by a newline")
+	}
+
+	return Record{
+		Time:     t,
+		Telegram: telegram[:length],
+	}, nil
+}
+
+func parseHeader(header string) (time.Time, int, error) {
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[0] != "#" {
+		return time.Time{}, 0, fmt.Errorf("invalid record header %q", header)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, fields[1])
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid time in record header %q: %w", header, err)
+	}
+
+	length, err := strconv.Atoi(fields[2])
+	if err != nil || length < 0 || length > maxTelegramSize {
+		return time.Time{}, 0, fmt.Errorf("invalid length in record header %q", header)
+	}
+
+	return t, length, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
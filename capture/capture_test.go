@@ -0,0 +1,179 @@
+package capture_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/koesie10/smartmeter/capture"
+)
+
+func TestCapture(t *testing.T) {
+	telegram, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2023, 10, 29, 1, 30, 0, 123456789, time.UTC)
+
+	var buf bytes.Buffer
+	w := capture.NewWriter(&buf)
+	for i := 0; i < 3; i++ {
+		if err := w.Write(start.Add(time.Duration(i)*time.Second), telegram); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	if _, err := gw.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"plain": buf.Bytes(), "gzip": compressed.Bytes()} {
+		r, err := capture.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		for i := 0; i < 3; i++ {
+			record, err := r.Next()
+			if err != nil {
+				t.Fatalf("%s: record %d: %v", name, i, err)
+			}
+			if expected := start.Add(time.Duration(i) * time.Second); !record.Time.Equal(expected) {
+				t.Errorf("%s: record %d: expected time %v, got %v", name, i, expected, record.Time)
+			}
+			if !bytes.Equal(record.Telegram, telegram) {
+				t.Errorf("%s: record %d: telegram does not match", name, i)
+			}
+		}
+
+		if _, err := r.Next(); !errors.Is(err, io.EOF) {
+			t.Errorf("%s: expected io.EOF, got %v", name, err)
+		}
+	}
+
+	r, err := capture.NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-10]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF for a truncated capture, got %v", err)
+	}
+}
+
+func TestFileRotate(t *testing.T) {
+	telegram, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "capture.dsmr")
+
+	f, err := capture.OpenFile(capture.FileOptions{
+		Filename:   filename,
+		RotateSize: 1,
+		Gzip:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2023, 10, 29, 1, 30, 0, 0, time.UTC)
+	times := make([]time.Time, 4)
+	for i := range times {
+		times[i] = start.Add(time.Duration(i) * 100 * time.Millisecond)
+	}
+
+	// The capture file is rotated twice in the same second
+	for _, ti := range times[:3] {
+		if err := f.Write(ti, telegram); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rotating fails when the capture file is removed, after which a new capture file is written
+	if err := os.Remove(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write(times[3], telegram); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write(times[3], telegram); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected %v after Close, got %v", os.ErrClosed, err)
+	}
+
+	for _, name := range []string{"capture-20231029T013000Z.dsmr.gz", "capture-20231029T013000Z-1.dsmr.gz"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected rotated file %s: %v", name, err)
+		}
+	}
+
+	// The capture file is rotated and compressed on Close
+	if _, err := os.Stat(filename); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected capture file to be rotated on Close, got %v", err)
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 {
+		t.Fatalf("expected 3 rotated files, got %v", names)
+	}
+
+	var recorded []time.Time
+	for _, name := range names {
+		if filepath.Ext(name) != ".gz" {
+			t.Errorf("expected %s to be compressed", name)
+		}
+
+		file, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		r, err := capture.NewReader(file)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for {
+			record, err := r.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			recorded = append(recorded, record.Time)
+		}
+	}
+
+	// The telegram in the removed capture file is lost
+	expected := []time.Time{times[0], times[1], times[3]}
+	slices.SortFunc(recorded, time.Time.Compare)
+	if !slices.EqualFunc(recorded, expected, time.Time.Equal) {
+		t.Errorf("expected records at %v, got %v", expected, recorded)
+	}
+}
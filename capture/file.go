@@ -0,0 +1,224 @@
+package capture
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type FileOptions struct {
+	Filename       string        `env:"RECORD_OUTPUT" flag:"output" desc:"capture file to write the telegrams to, rotated files are written next to it"`
+	RotateSize     int64         `env:"RECORD_ROTATE_SIZE" flag:"rotate-size" desc:"size in bytes after which the capture file is rotated, 0 to disable"`
+	RotateInterval time.Duration `env:"RECORD_ROTATE_INTERVAL" flag:"rotate-interval" desc:"interval at which the capture file is rotated, such as 24h, 0 to disable"`
+	Gzip           bool          `env:"RECORD_GZIP" flag:"gzip" desc:"compress rotated capture files with gzip, the capture file is also rotated when recording stops"`
+}
+
+// File writes records to a capture file, which is rotated when it becomes too large or too old. Rotated files are
+// renamed to the name of the capture file with the time of rotation, such as capture-20231029T013000Z.dsmr, with a
+// counter added when the name is already used, such as capture-20231029T013000Z-1.dsmr.
+type File struct {
+	options FileOptions
+
+	mu      sync.Mutex
+	closed  bool
+	f       *os.File
+	w       *Writer
+	size    int64
+	started time.Time
+
+	// compressing is used to wait for rotated files that are being compressed
+	compressing sync.WaitGroup
+}
+
+// OpenFile opens the capture file, appending to it if it already exists.
+func OpenFile(options FileOptions) (*File, error) {
+	f := &File{
+		options: options,
+	}
+
+	if err := f.open(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *File) open(t time.Time) error {
+	file, err := os.OpenFile(f.options.Filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open capture file %s: %w", f.options.Filename, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat capture file %s: %w", f.options.Filename, err)
+	}
+
+	f.f = file
+	f.size = info.Size()
+	f.w = NewWriter(&countingWriter{w: file, n: &f.size})
+	f.started = t
+
+	return nil
+}
+
+// Write writes a record for the telegram received at t, rotating the capture file first if needed.
+func (f *File) Write(t time.Time, telegram []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+
+	if f.f != nil && f.shouldRotate(t) {
+		// The telegram is still written when rotating fails, and rotating is retried with the next telegram
+		if err := f.rotate(t); err != nil {
+			log.Print(err)
+		}
+	}
+
+	// The capture file is not open after rotating it or after opening it failed
+	if f.f == nil {
+		if err := f.open(t); err != nil {
+			return err
+		}
+	}
+
+	return f.w.Write(t, telegram)
+}
+
+func (f *File) shouldRotate(t time.Time) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.options.RotateSize > 0 && f.size >= f.options.RotateSize {
+		return true
+	}
+	if f.options.RotateInterval > 0 && !t.Truncate(f.options.RotateInterval).Equal(f.started.Truncate(f.options.RotateInterval)) {
+		return true
+	}
+	return false
+}
+
+// rotate closes the capture file and renames it, after which it needs to be opened again.
+func (f *File) rotate(t time.Time) error {
+	err := f.f.Close()
+	f.f = nil
+	if err != nil {
+		return fmt.Errorf("failed to close capture file %s: %w", f.options.Filename, err)
+	}
+
+	rotated := f.rotatedName(t)
+
+	if err := os.Rename(f.options.Filename, rotated); err != nil {
+		return fmt.Errorf("failed to rotate capture file %s: %w", f.options.Filename, err)
+	}
+
+	if f.options.Gzip {
+		f.compressing.Add(1)
+		go func() {
+			defer f.compressing.Done()
+
+			if err := compressFile(rotated); err != nil {
+				log.Printf("Failed to compress capture file %s: %v", rotated, err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// rotatedName returns the name to rotate the capture file to at t, which is not used by another rotated file yet.
+func (f *File) rotatedName(t time.Time) string {
+	ext := filepath.Ext(f.options.Filename)
+	base := fmt.Sprintf("%s-%s", strings.TrimSuffix(f.options.Filename, ext), t.UTC().Format("20060102T150405Z"))
+
+	name := base + ext
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+
+	return name
+}
+
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+// Close closes the capture file and waits for rotated files to be compressed. When compression is enabled, the capture
+// file is rotated as well, so all recorded telegrams end up in compressed files.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	var err error
+	if f.f != nil {
+		if f.options.Gzip && f.size > 0 {
+			err = f.rotate(time.Now())
+		} else {
+			err = f.f.Close()
+			f.f = nil
+		}
+	}
+
+	f.compressing.Wait()
+
+	return err
+}
+
+// compressFile compresses the file to a file with the .gz extension and removes the original file.
+func compressFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(out)
+	if _, err := io.Copy(gw, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+
+	return os.Remove(name)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	*w.n += int64(n)
+	return n, err
+}
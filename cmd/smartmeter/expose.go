@@ -1,72 +1,173 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
-	"github.com/koesie10/smartmeter/serialinput"
-	"github.com/spf13/cobra"
 	"log"
 	"net"
-	"sync"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+
+	"github.com/koesie10/pflagenv"
+	"github.com/koesie10/smartmeter/expose"
+	"github.com/koesie10/smartmeter/serialinput"
+	"github.com/koesie10/smartmeter/smartmeter"
+	"github.com/spf13/cobra"
 )
 
-var exposeOptions = struct {
-	Addr string
-}{}
+var exposeConfig = struct {
+	Addr         string        `env:"EXPOSE_ADDR" flag:"addr" desc:"TCP server address of the raw telegrams, set empty to disable"`
+	HTTPAddr     string        `env:"EXPOSE_HTTP_ADDR" flag:"http-addr" desc:"HTTP server address of the latest telegram and packet and the packet streams, set empty to disable"`
+	QueueSize    int           `env:"EXPOSE_QUEUE_SIZE" flag:"queue-size" desc:"number of telegrams that are queued for a client before its oldest telegrams are dropped"`
+	WriteTimeout time.Duration `env:"EXPOSE_WRITE_TIMEOUT" flag:"write-timeout" desc:"time after which a client that does not receive a telegram is disconnected"`
+
+	UnixSocket    string `env:"EXPOSE_UNIX_SOCKET" flag:"unix-socket" desc:"path of a Unix domain socket to send the raw telegrams on, leave empty to disable"`
+	MulticastAddr string `env:"EXPOSE_MULTICAST_ADDR" flag:"multicast-addr" desc:"UDP multicast group and port to send every raw telegram to as a single datagram, such as 239.255.80.49:8888, leave empty to disable"`
+
+	TLS          expose.TLSOptions `env:",squash"`
+	AllowedCIDRs []string          `env:"EXPOSE_ALLOWED_CIDRS" flag:"allowed-cidrs" desc:"CIDRs of the clients that are allowed to connect, such as 192.168.1.0/24, leave empty to allow all clients"`
+}{
+	Addr:         ":8888",
+	QueueSize:    10,
+	WriteTimeout: 30 * time.Second,
+}
 
 var exposeCmd = &cobra.Command{
 	Use:   "expose",
-	Short: "send all raw datagram packets over a TCP server",
+	Short: "send all raw telegrams over TCP, a Unix domain socket or UDP multicast and the parsed packets over HTTP",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := pflagenv.Parse(&exposeConfig); err != nil {
+			return err
+		}
+
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
 		port, err := serialinput.Open(&config.Options)
 		if err != nil {
 			return fmt.Errorf("failed to open port: %v", err)
 		}
 		defer port.Close()
 
-		l, err := net.Listen("tcp", exposeOptions.Addr)
+		tlsConfig, err := expose.NewTLSConfig(exposeConfig.TLS)
 		if err != nil {
-			return fmt.Errorf("failed to listen on address %v: %v", exposeOptions.Addr, err)
+			return err
 		}
-		defer l.Close()
 
-		connections := make(map[net.Conn]struct{}, 100)
-		connMutex := sync.Mutex{}
+		hub := expose.NewHub(exposeConfig.QueueSize)
 
-		go func() {
-			for {
-				conn, err := l.Accept()
-				if err != nil {
-					log.Println(fmt.Errorf("failed to listen on address %v: %v", exposeOptions.Addr, err))
-					continue
+		if exposeConfig.Addr != "" {
+			l, err := expose.Listen(exposeConfig.Addr, exposeConfig.AllowedCIDRs, tlsConfig)
+			if err != nil {
+				return err
+			}
+			defer l.Close()
+
+			go func() {
+				if err := expose.Serve(l, hub, exposeConfig.WriteTimeout); err != nil {
+					log.Println(fmt.Errorf("failed to accept connections on address %v: %v", exposeConfig.Addr, err))
 				}
+			}()
 
-				connMutex.Lock()
-				connections[conn] = struct{}{}
-				connMutex.Unlock()
+			log.Printf("Listening on %s", l.Addr())
+		}
+
+		if exposeConfig.UnixSocket != "" {
+			// A socket that was left behind by a previous run would prevent listening
+			if info, err := os.Lstat(exposeConfig.UnixSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+				os.Remove(exposeConfig.UnixSocket)
 			}
-		}()
 
-		buf := make([]byte, 32*1024)
-		for {
-			nr, err := port.Read(buf)
-			if nr > 0 {
-				connMutex.Lock()
-				for conn := range connections {
-					if err := conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
-						conn.Close()
-						delete(connections, conn)
-					}
-					if _, err := conn.Write(buf[:nr]); err != nil {
-						conn.Close()
-						delete(connections, conn)
-					}
+			l, err := net.Listen("unix", exposeConfig.UnixSocket)
+			if err != nil {
+				return fmt.Errorf("failed to listen on Unix domain socket %v: %v", exposeConfig.UnixSocket, err)
+			}
+			defer l.Close()
+
+			go func() {
+				if err := expose.Serve(l, hub, exposeConfig.WriteTimeout); err != nil {
+					log.Println(fmt.Errorf("failed to accept connections on Unix domain socket %v: %v", exposeConfig.UnixSocket, err))
 				}
-				connMutex.Unlock()
+			}()
+
+			log.Printf("Listening on %s", exposeConfig.UnixSocket)
+		}
+
+		if exposeConfig.MulticastAddr != "" {
+			conn, err := net.Dial("udp", exposeConfig.MulticastAddr)
+			if err != nil {
+				return fmt.Errorf("failed to dial multicast address %v: %v", exposeConfig.MulticastAddr, err)
 			}
+			defer conn.Close()
+
+			go expose.SendDatagrams(ctx, conn, hub)
+
+			log.Printf("Sending telegrams to %s", exposeConfig.MulticastAddr)
+		}
+
+		if exposeConfig.HTTPAddr != "" {
+			l, err := expose.Listen(exposeConfig.HTTPAddr, exposeConfig.AllowedCIDRs, tlsConfig)
+			if err != nil {
+				return err
+			}
+
+			server := &http.Server{
+				Handler: expose.NewHTTPHandler(hub, exposeConfig.WriteTimeout),
+				// Streams are written for as long as the client is connected, so only reading the headers has a timeout
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			defer server.Close()
+
+			go func() {
+				if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.Println(fmt.Errorf("failed to serve HTTP on address %v: %v", exposeConfig.HTTPAddr, err))
+				}
+			}()
+
+			log.Printf("Serving HTTP on %s", l.Addr())
+		}
+
+		// The telegrams are read by the scanner below, since the raw telegram is sent even when it cannot be parsed
+		sm, err := smartmeter.New(nil, config.Parser)
+		if err != nil {
+			return fmt.Errorf("failed to open smart meter: %v", err)
+		}
+
+		go func() {
+			<-ctx.Done()
+			port.Close()
+		}()
+
+		// Only complete telegrams are sent, so clients never receive a partial telegram
+		scanner := bufio.NewScanner(port)
+		scanner.Split(smartmeter.ScanTelegrams)
+
+		for scanner.Scan() {
+			telegram := expose.Telegram{
+				Raw: bytes.Clone(scanner.Bytes()),
+			}
+
+			// Telegrams that cannot be parsed are still sent as raw telegram
+			packet, err := sm.Parse(telegram.Raw)
 			if err != nil {
-				break
+				log.Println(err)
+			} else {
+				telegram.Packet = packet
 			}
+
+			hub.Publish(telegram)
+		}
+
+		if err := scanner.Err(); err != nil && ctx.Err() == nil && !errors.Is(err, os.ErrClosed) {
+			return fmt.Errorf("failed to read telegram: %w", err)
 		}
 
 		return nil
@@ -75,5 +176,8 @@ var exposeCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(exposeCmd)
-	exposeCmd.Flags().StringVar(&exposeOptions.Addr, "addr", ":8888", "TCP server address")
+
+	if err := pflagenv.Setup(exposeCmd.Flags(), &exposeConfig); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -3,6 +3,10 @@ package main
 import (
 	"fmt"
 	"os"
+
+	// Embed the timezone database, since the timezone of the telegrams is loaded by name and the hosts smartmeter runs
+	// on, such as routers and containers, often do not have one
+	_ "time/tzdata"
 )
 
 func main() {
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/koesie10/pflagenv"
@@ -12,6 +16,7 @@ import (
 	"github.com/koesie10/smartmeter/prometheus"
 	"github.com/koesie10/smartmeter/serialinput"
 	"github.com/koesie10/smartmeter/smartmeter"
+	prometheusclient "github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 )
 
@@ -42,6 +47,10 @@ var publishConfig = struct {
 		ElectricityMeasurementName: "smartmeter_electricity",
 		PhaseMeasurementName:       "smartmeter_phase",
 		GasMeasurementName:         "smartmeter_gas",
+		MBusMeasurementName:        "smartmeter_mbus",
+
+		MaximumDemandMeasurementName: "smartmeter_maximum_demand",
+		MessageMeasurementName:       "smartmeter_message",
 	},
 
 	Prometheus: prometheus.PublisherOptions{
@@ -60,11 +69,20 @@ var publishCmd = &cobra.Command{
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runPublish()
+		ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		return runPublish(ctx)
 	},
 }
 
-func runPublish() error {
+func runPublish(ctx context.Context) error {
+	port, err := serialinput.Open(&config.Options)
+	if err != nil {
+		return fmt.Errorf("failed to open port: %v", err)
+	}
+	defer port.Close()
+
 	var publishers []smartmeter.Publisher
 
 	if publishConfig.EnableJSONDebug {
@@ -94,6 +112,10 @@ func runPublish() error {
 			ElectricityMeasurementName: "smartmeter_electricity",
 			PhaseMeasurementName:       "smartmeter_phase",
 			GasMeasurementName:         "smartmeter_gas",
+			MBusMeasurementName:        "smartmeter_mbus",
+
+			MaximumDemandMeasurementName: "smartmeter_maximum_demand",
+			MessageMeasurementName:       "smartmeter_message",
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create InfluxDB debug publisher: %w", err)
@@ -105,7 +127,16 @@ func runPublish() error {
 	}
 
 	if publishConfig.Prometheus.Addr != "" {
-		publisher, err := prometheus.NewPublisher(publishConfig.Prometheus)
+		inputReconnects := prometheusclient.NewCounterFunc(prometheusclient.CounterOpts{
+			Name:      "reconnects_total",
+			Help:      "Number of times the input was reopened after reading from it failed",
+			Subsystem: "input",
+			Namespace: "smartmeter",
+		}, func() float64 {
+			return float64(serialinput.Reconnects(port))
+		})
+
+		publisher, err := prometheus.NewPublisher(publishConfig.Prometheus, inputReconnects)
 		if err != nil {
 			return fmt.Errorf("failed to create Prometheus publisher: %w", err)
 		}
@@ -126,33 +157,34 @@ func runPublish() error {
 		logger.Info("MQTT publisher enabled")
 	}
 
-	port, err := serialinput.Open(&config.Options)
-	if err != nil {
-		return fmt.Errorf("failed to open port: %v", err)
-	}
-	defer port.Close()
-
-	sm, err := smartmeter.New(port)
+	sm, err := smartmeter.New(port, config.Parser)
 	if err != nil {
 		return fmt.Errorf("failed to open smart meter: %v", err)
 	}
 
-	for {
-		packet, err := sm.Read()
-		if err != nil {
-			if _, ok := err.(*smartmeter.ParseError); !ok {
-				return fmt.Errorf("failed to read packet: %v", err)
+	for result := range sm.Stream(ctx) {
+		if result.Err != nil {
+			if !smartmeter.IsRecoverable(result.Err) {
+				return fmt.Errorf("failed to read packet: %v", result.Err)
 			}
-			log.Println(err)
+			log.Println(result.Err)
 			continue
 		}
 
+		for _, warning := range result.Packet.Warnings {
+			log.Println(warning.Message)
+		}
+
 		for _, publisher := range publishers {
-			if err := publisher.Publish(packet); err != nil {
+			if err := publisher.Publish(result.Packet); err != nil {
 				log.Println(err)
 			}
 		}
 	}
+
+	logger.Info("Shutting down")
+
+	return nil
 }
 
 func init() {
@@ -21,7 +21,7 @@ var readCmd = &cobra.Command{
 		}
 		defer port.Close()
 
-		sm, err := smartmeter.New(port)
+		sm, err := smartmeter.New(port, config.Parser)
 		if err != nil {
 			return fmt.Errorf("failed to open smart meter: %v", err)
 		}
@@ -32,8 +32,17 @@ var readCmd = &cobra.Command{
 		}
 
 		tw := tabwriter.NewWriter(os.Stdout, 10, 0, 2, ' ', tabwriter.AlignRight)
-		fmt.Fprintln(tw, "Time\tTotal kWh Tariff 1 Consumed\tTotal kWh Tariff 2 consumed\tTotal gas consumed m^3\tCurrent consumption kW\tGas Measured At")
-		fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\t%.3f\t%s", time.Now(), packet.Electricity.Tariffs[0].Consumed, packet.Electricity.Tariffs[1].Consumed, packet.Gas.Consumed, packet.Electricity.CurrentConsumed-packet.Electricity.CurrentProduced, packet.Gas.MeasuredAt)
+		fmt.Fprint(tw, "Time\t")
+		for _, tariff := range packet.Electricity.Tariffs {
+			fmt.Fprintf(tw, "Total kWh Tariff %d Consumed\t", tariff.Number)
+		}
+		fmt.Fprintln(tw, "Total gas consumed m^3\tCurrent consumption kW\tGas Measured At")
+
+		fmt.Fprintf(tw, "%s\t", time.Now())
+		for _, tariff := range packet.Electricity.Tariffs {
+			fmt.Fprintf(tw, "%.3f\t", tariff.Consumed)
+		}
+		fmt.Fprintf(tw, "%.3f\t%.3f\t%s", packet.Gas.Consumed, packet.Electricity.CurrentConsumed-packet.Electricity.CurrentProduced, packet.Gas.MeasuredAt)
 		return tw.Flush()
 	},
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/koesie10/pflagenv"
+	"github.com/koesie10/smartmeter/capture"
+	"github.com/koesie10/smartmeter/serialinput"
+	"github.com/koesie10/smartmeter/smartmeter"
+	"github.com/spf13/cobra"
+)
+
+var recordConfig = struct {
+	capture.FileOptions `env:",squash"`
+}{
+	FileOptions: capture.FileOptions{
+		Filename:       "capture.dsmr",
+		RotateInterval: 24 * time.Hour,
+	},
+}
+
+var recordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "Record all raw telegrams with the time they were received to a capture file, which can be replayed with --capture",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := pflagenv.Parse(&recordConfig); err != nil {
+			return err
+		}
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		file, err := capture.OpenFile(recordConfig.FileOptions)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		port, err := serialinput.Open(&config.Options)
+		if err != nil {
+			return fmt.Errorf("failed to open port: %v", err)
+		}
+		defer port.Close()
+
+		go func() {
+			<-ctx.Done()
+			port.Close()
+		}()
+
+		log.Printf("Recording telegrams to %s", recordConfig.Filename)
+
+		// Telegrams are recorded without verifying them, so broken telegrams can be reproduced as well
+		scanner := bufio.NewScanner(port)
+		scanner.Split(smartmeter.ScanTelegrams)
+
+		var count int
+		for scanner.Scan() {
+			if err := file.Write(time.Now(), scanner.Bytes()); err != nil {
+				return err
+			}
+			count++
+		}
+
+		if err := scanner.Err(); err != nil && ctx.Err() == nil && !errors.Is(err, os.ErrClosed) {
+			return fmt.Errorf("failed to read telegram: %w", err)
+		}
+
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to close capture file: %w", err)
+		}
+
+		log.Printf("Recorded %d telegrams", count)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recordCmd)
+
+	if err := pflagenv.Setup(recordCmd.Flags(), &recordConfig); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/jacobsa/go-serial/serial"
 	"github.com/koesie10/pflagenv"
 	"github.com/koesie10/smartmeter/serialinput"
+	"github.com/koesie10/smartmeter/smartmeter"
 	"github.com/koesie10/smartmeter/version"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -15,6 +16,8 @@ import (
 
 var config = struct {
 	serialinput.Options `env:",squash"`
+
+	Parser smartmeter.Options `env:",squash"`
 }{
 	Options: serialinput.Options{
 		InputType: serialinput.SerialPort,
@@ -25,6 +28,9 @@ var config = struct {
 			DataBits:   8,
 			StopBits:   1,
 			ParityMode: serialinput.ParityMode(serial.PARITY_NONE),
+
+			// DSMR 2.2 and 4 meters send a telegram every 10 seconds
+			AutoTimeout: 25 * time.Second,
 		},
 
 		File: &serialinput.FileOptions{
@@ -39,6 +45,27 @@ var config = struct {
 			DialTimeout: 10 * time.Second,
 			ReadTimeout: 10 * time.Second,
 		},
+
+		HTTP: &serialinput.HTTPOptions{
+			Interval: 1 * time.Second,
+			Timeout:  5 * time.Second,
+		},
+
+		MQTTInput: &serialinput.MQTTOptions{
+			Brokers: []string{"tcp://127.0.0.1:1883"},
+			Topic:   "smartmeter/telegram",
+		},
+
+		Decryption: &serialinput.DecryptionOptions{
+			// This is the authentication key used by all Luxembourg Smarty meters
+			AuthenticationKey: "00112233445566778899AABBCCDDEEFF",
+		},
+
+		Reconnect: &serialinput.ReconnectOptions{
+			Enabled:    true,
+			MinBackoff: 1 * time.Second,
+			MaxBackoff: 1 * time.Minute,
+		},
 	},
 }
 
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/koesie10/pflagenv"
+	"github.com/koesie10/smartmeter/simulator"
+	"github.com/koesie10/smartmeter/smartmeter"
+	"github.com/spf13/cobra"
+)
+
+var simulateConfig = struct {
+	simulator.Options `env:",squash"`
+
+	Output  string `env:"SIMULATE_OUTPUT" flag:"output" desc:"output to write the telegrams to: stdout, tcp or pty"`
+	Addr    string `env:"SIMULATE_ADDR" flag:"addr" desc:"TCP address to listen on for the tcp output"`
+	PTYLink string `env:"SIMULATE_PTY_LINK" flag:"pty-link" desc:"path of a symlink to create to the pseudo-terminal for the pty output, such as /tmp/ttyP1"`
+}{
+	Options: simulator.Options{
+		DSMRVersion:          smartmeter.DSMR5,
+		Phases:               3,
+		SolarPeak:            3,
+		PowerFailureInterval: 24 * time.Hour,
+	},
+
+	Output: "stdout",
+	Addr:   ":8888",
+}
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Simulate a smart meter by writing generated telegrams to stdout, a TCP server or a pseudo-terminal",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := pflagenv.Parse(&simulateConfig); err != nil {
+			return err
+		}
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		generator, err := simulator.NewGenerator(simulateConfig.Options)
+		if err != nil {
+			return fmt.Errorf("failed to create generator: %w", err)
+		}
+
+		var w io.Writer
+
+		switch simulateConfig.Output {
+		case "stdout":
+			w = os.Stdout
+		case "tcp":
+			l, err := net.Listen("tcp", simulateConfig.Addr)
+			if err != nil {
+				return fmt.Errorf("failed to listen on address %v: %w", simulateConfig.Addr, err)
+			}
+
+			tw := simulator.NewTCPWriter(l, generator.Interval())
+			defer tw.Close()
+			w = tw
+
+			log.Printf("Listening on %s", l.Addr())
+		case "pty":
+			pty, name, err := simulator.OpenPTY(generator.Interval())
+			if err != nil {
+				return err
+			}
+			defer pty.Close()
+			w = pty
+
+			if simulateConfig.PTYLink != "" {
+				_ = os.Remove(simulateConfig.PTYLink)
+				if err := os.Symlink(name, simulateConfig.PTYLink); err != nil {
+					return fmt.Errorf("failed to create symlink to %s: %w", name, err)
+				}
+				defer os.Remove(simulateConfig.PTYLink)
+
+				name = simulateConfig.PTYLink
+			}
+
+			log.Printf("Writing telegrams to %s", name)
+		default:
+			return fmt.Errorf("unknown output %q", simulateConfig.Output)
+		}
+
+		return generator.Run(ctx, w)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+
+	if err := pflagenv.Setup(simulateCmd.Flags(), &simulateConfig); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,37 @@
+package expose
+
+import (
+	"context"
+	"log"
+	"net"
+)
+
+// maxDatagramSize is the maximum size of the payload of a UDP datagram.
+const maxDatagramSize = 65507
+
+// SendDatagrams writes every telegram of the hub as a single datagram to conn, such as a UDP connection to a multicast
+// group, until ctx is done.
+func SendDatagrams(ctx context.Context, conn net.Conn, hub *Hub) {
+	s := hub.Subscribe()
+	defer s.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case telegram, ok := <-s.Telegrams():
+			if !ok {
+				return
+			}
+
+			if len(telegram.Raw) > maxDatagramSize {
+				log.Printf("Skipped telegram of %d bytes, which does not fit in a datagram", len(telegram.Raw))
+				continue
+			}
+
+			if _, err := conn.Write(telegram.Raw); err != nil {
+				log.Printf("Failed to send telegram to %s: %v", conn.RemoteAddr(), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package expose_test
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/koesie10/smartmeter/expose"
+	"github.com/koesie10/smartmeter/serialinput"
+	"github.com/koesie10/smartmeter/smartmeter"
+)
+
+func TestSendDatagrams(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Find a free port for the network input to listen on
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	r, err := serialinput.OpenNetwork(&serialinput.NetworkOptions{
+		Type:        "udp",
+		Address:     addr,
+		ReadTimeout: time.Second,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	hub := expose.NewHub(10)
+	hub.Publish(expose.Telegram{Raw: raw})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go expose.SendDatagrams(ctx, conn, hub)
+
+	sm, err := smartmeter.New(r, smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.Read(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendDatagramsMulticast(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iface, ip := multicastInterface(t)
+
+	// Find a free port for the multicast group
+	pc, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 80, 49), Port: pc.LocalAddr().(*net.UDPAddr).Port}
+	pc.Close()
+
+	if _, err := serialinput.OpenNetwork(&serialinput.NetworkOptions{
+		Type:               "udp4",
+		Address:            group.String(),
+		MulticastInterface: "does-not-exist",
+	}, nil); err == nil {
+		t.Error("expected error for unknown multicast interface")
+	}
+
+	r, err := serialinput.OpenNetwork(&serialinput.NetworkOptions{
+		Type:               "udp4",
+		Address:            group.String(),
+		ReadTimeout:        time.Second,
+		MulticastInterface: iface.Name,
+	}, nil)
+	if err != nil {
+		t.Skipf("failed to join multicast group on %s: %v", iface.Name, err)
+	}
+	defer r.Close()
+
+	// Binding to the address of the interface sends the datagrams on that interface, where they are looped back
+	conn, err := net.DialUDP("udp4", &net.UDPAddr{IP: ip}, group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	hub := expose.NewHub(10)
+	hub.Publish(expose.Telegram{Raw: raw})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go expose.SendDatagrams(ctx, conn, hub)
+
+	sm, err := smartmeter.New(r, smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.Read(); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Skipf("no multicast datagram received on %s: %v", iface.Name, err)
+		}
+		t.Fatal(err)
+	}
+}
+
+// multicastInterface returns an interface that is up and supports multicast with its IPv4 address, preferring the
+// loopback interface, or skips the test if there is none.
+func multicastInterface(t *testing.T) (*net.Interface, net.IP) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Skipf("failed to list interfaces: %v", err)
+	}
+
+	slices.SortStableFunc(ifaces, func(a, b net.Interface) int {
+		return cmp.Compare(b.Flags&net.FlagLoopback, a.Flags&net.FlagLoopback)
+	})
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				return &iface, ipNet.IP
+			}
+		}
+	}
+
+	t.Skip("no interface with multicast support")
+	return nil, nil
+}
+
+func TestServeUnixSocket(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "smartmeter.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	hub := expose.NewHub(10)
+	hub.Publish(expose.Telegram{Raw: raw})
+	go expose.Serve(l, hub, time.Second)
+
+	r, err := serialinput.OpenNetwork(&serialinput.NetworkOptions{
+		Type:        "unix",
+		Address:     path,
+		DialTimeout: time.Second,
+		ReadTimeout: time.Second,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	sm, err := smartmeter.New(r, smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.Read(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,175 @@
+package expose
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketPingInterval is the interval at which WebSocket clients are pinged, so dead connections are detected.
+const websocketPingInterval = 30 * time.Second
+
+// NewHTTPHandler returns a handler that serves the telegrams of the hub:
+//
+//   - GET /telegram/latest returns the most recent raw telegram as text
+//   - GET /packet/latest returns the packet of the most recent telegram as JSON
+//   - GET /packet/events streams the packets as Server-Sent Events
+//   - GET /packet/ws streams the packets as JSON text messages over a WebSocket
+//
+// Streams start with the packet of the most recent telegram. Telegrams that could not be parsed are only available as
+// raw telegram.
+func NewHTTPHandler(hub *Hub, writeTimeout time.Duration) http.Handler {
+	h := &httpHandler{
+		hub:          hub,
+		writeTimeout: writeTimeout,
+		upgrader: websocket.Upgrader{
+			// Dashboards on the LAN are served from other origins
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /telegram/latest", h.latestTelegram)
+	mux.HandleFunc("GET /packet/latest", h.latestPacket)
+	mux.HandleFunc("GET /packet/events", h.packetEvents)
+	mux.HandleFunc("GET /packet/ws", h.packetWebSocket)
+
+	return mux
+}
+
+type httpHandler struct {
+	hub          *Hub
+	writeTimeout time.Duration
+	upgrader     websocket.Upgrader
+}
+
+func (h *httpHandler) latestTelegram(w http.ResponseWriter, r *http.Request) {
+	telegram := h.hub.Latest()
+	if telegram.Raw == nil {
+		http.Error(w, "no telegram has been received yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(telegram.Raw)
+}
+
+func (h *httpHandler) latestPacket(w http.ResponseWriter, r *http.Request) {
+	telegram := h.hub.Latest()
+	if telegram.Packet == nil {
+		http.Error(w, "no telegram has been received yet or the latest telegram could not be parsed", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(telegram.Packet); err != nil {
+		log.Printf("Failed to write packet: %v", err)
+	}
+}
+
+func (h *httpHandler) packetEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	s := h.hub.Subscribe()
+	defer s.Close()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case telegram, ok := <-s.Telegrams():
+			if !ok {
+				return
+			}
+			if telegram.Packet == nil {
+				continue
+			}
+
+			data, err := json.Marshal(telegram.Packet)
+			if err != nil {
+				log.Printf("Failed to marshal packet: %v", err)
+				continue
+			}
+
+			_ = rc.SetWriteDeadline(h.deadline())
+			if _, err := fmt.Fprintf(w, "event: packet\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *httpHandler) packetWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		return
+	}
+	defer conn.Close()
+
+	s := h.hub.Subscribe()
+	defer s.Close()
+
+	// Messages of the client are discarded, but reading is needed to process control messages and to detect that the
+	// client closed the connection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(websocketPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, h.deadline()); err != nil {
+				return
+			}
+		case telegram, ok := <-s.Telegrams():
+			if !ok {
+				return
+			}
+			if telegram.Packet == nil {
+				continue
+			}
+
+			_ = conn.SetWriteDeadline(h.deadline())
+			if err := conn.WriteJSON(telegram.Packet); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// deadline returns the deadline of a write that is started now, which is the zero time if there is no write timeout.
+func (h *httpHandler) deadline() time.Time {
+	if h.writeTimeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(h.writeTimeout)
+}
@@ -0,0 +1,112 @@
+package expose_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/koesie10/smartmeter/expose"
+	"github.com/koesie10/smartmeter/smartmeter"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm, err := smartmeter.New(nil, smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet, err := sm.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := expose.NewHub(10)
+	server := httptest.NewServer(expose.NewHTTPHandler(hub, time.Second))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/packet/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d before the first telegram, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	hub.Publish(expose.Telegram{Raw: raw, Packet: packet})
+
+	resp, err = http.Get(server.URL + "/telegram/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != string(raw) {
+		t.Errorf("expected the latest raw telegram, got %q", body)
+	}
+
+	resp, err = http.Get(server.URL + "/packet/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var latest smartmeter.P1Packet
+	err = json.NewDecoder(resp.Body).Decode(&latest)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Electricity.EquipmentID != packet.Electricity.EquipmentID {
+		t.Errorf("expected equipment ID %q, got %q", packet.Electricity.EquipmentID, latest.Electricity.EquipmentID)
+	}
+
+	resp, err = http.Get(server.URL + "/packet/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1024*1024)
+	var event, data string
+	for scanner.Scan() && scanner.Text() != "" {
+		if value, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			event = value
+		}
+		if value, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			data = value
+		}
+	}
+	resp.Body.Close()
+	if event != "packet" || !strings.Contains(data, packet.Electricity.EquipmentID) {
+		t.Errorf("expected a packet event with the latest packet, got event %q with data %q", event, data)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/packet/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var streamed smartmeter.P1Packet
+	if err := conn.ReadJSON(&streamed); err != nil {
+		t.Fatal(err)
+	}
+	if streamed.Electricity.EquipmentID != packet.Electricity.EquipmentID {
+		t.Errorf("expected equipment ID %q, got %q", packet.Electricity.EquipmentID, streamed.Electricity.EquipmentID)
+	}
+}
@@ -0,0 +1,130 @@
+// Package expose distributes telegrams to clients, such as other instances of smartmeter that read from the network
+// input over TCP and dashboards that read the parsed packets over HTTP.
+package expose
+
+import (
+	"sync"
+
+	"github.com/koesie10/smartmeter/smartmeter"
+)
+
+// Telegram is a raw telegram and the packet that was parsed from it.
+type Telegram struct {
+	Raw []byte
+	// Packet is nil if the telegram could not be parsed
+	Packet *smartmeter.P1Packet
+}
+
+// Hub distributes complete telegrams to its subscribers. Every subscriber has its own bounded queue, so a slow
+// subscriber does not hold up the others. When the queue of a subscriber is full, its oldest telegram is dropped.
+type Hub struct {
+	queueSize int
+
+	mu          sync.Mutex
+	latest      Telegram
+	subscribers map[*Subscription]struct{}
+}
+
+// NewHub returns a hub that queues at most queueSize telegrams for each subscriber.
+func NewHub(queueSize int) *Hub {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	return &Hub{
+		queueSize:   queueSize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish sends the telegram to all subscribers. The telegram must not be modified afterwards.
+func (h *Hub) Publish(telegram Telegram) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.latest = telegram
+
+	for s := range h.subscribers {
+		s.enqueue(telegram)
+	}
+}
+
+// Latest returns the most recently published telegram, which has a nil Raw if no telegram has been published yet.
+func (h *Hub) Latest() Telegram {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.latest
+}
+
+// Subscribe returns a subscription that receives all telegrams published after it was created, starting with the most
+// recently published telegram.
+func (h *Hub) Subscribe() *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := &Subscription{
+		hub:       h,
+		telegrams: make(chan Telegram, h.queueSize),
+	}
+
+	if h.latest.Raw != nil {
+		s.enqueue(h.latest)
+	}
+
+	h.subscribers[s] = struct{}{}
+
+	return s
+}
+
+// Subscription is a subscription to the telegrams of a Hub.
+type Subscription struct {
+	hub *Hub
+
+	telegrams chan Telegram
+	dropped   uint64
+}
+
+// Telegrams returns the channel on which telegrams are received. The channel is closed when the subscription is closed.
+func (s *Subscription) Telegrams() <-chan Telegram {
+	return s.telegrams
+}
+
+// Dropped returns the number of telegrams that were dropped because the queue was full.
+func (s *Subscription) Dropped() uint64 {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return s.dropped
+}
+
+// enqueue adds the telegram to the queue, dropping the oldest telegram if the queue is full. It must be called with
+// the lock of the hub held.
+func (s *Subscription) enqueue(telegram Telegram) {
+	for {
+		select {
+		case s.telegrams <- telegram:
+			return
+		default:
+		}
+
+		select {
+		case <-s.telegrams:
+			s.dropped++
+		default:
+		}
+	}
+}
+
+// Close removes the subscription from the hub and closes its channel.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, ok := s.hub.subscribers[s]; !ok {
+		return
+	}
+
+	delete(s.hub.subscribers, s)
+	close(s.telegrams)
+}
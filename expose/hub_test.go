@@ -0,0 +1,39 @@
+package expose_test
+
+import (
+	"testing"
+
+	"github.com/koesie10/smartmeter/expose"
+)
+
+func TestHub(t *testing.T) {
+	hub := expose.NewHub(2)
+
+	hub.Publish(expose.Telegram{Raw: []byte("1")})
+
+	// A new subscriber starts with the latest telegram, which is the first to be dropped when the subscriber lags
+	s := hub.Subscribe()
+	defer s.Close()
+
+	hub.Publish(expose.Telegram{Raw: []byte("2")})
+	hub.Publish(expose.Telegram{Raw: []byte("3")})
+
+	for _, expected := range []string{"2", "3"} {
+		if telegram := <-s.Telegrams(); string(telegram.Raw) != expected {
+			t.Errorf("expected telegram %s, got %s", expected, telegram.Raw)
+		}
+	}
+	if dropped := s.Dropped(); dropped != 1 {
+		t.Errorf("expected 1 dropped telegram, got %d", dropped)
+	}
+
+	if latest := hub.Latest(); string(latest.Raw) != "3" {
+		t.Errorf("expected latest telegram 3, got %s", latest.Raw)
+	}
+
+	s.Close()
+	if _, ok := <-s.Telegrams(); ok {
+		t.Errorf("expected the channel to be closed")
+	}
+	hub.Publish(expose.Telegram{Raw: []byte("4")})
+}
@@ -0,0 +1,74 @@
+package expose
+
+import (
+	"errors"
+	"log"
+	"net"
+	"time"
+)
+
+// Serve accepts connections on l, such as a TCP listener or a Unix domain socket, and writes the telegrams of the hub to
+// them until l is closed. A connection is closed when writing a telegram takes longer than writeTimeout.
+func Serve(l net.Listener, hub *Hub, writeTimeout time.Duration) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("Failed to accept connection: %v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			return err
+		}
+
+		go serveConn(conn, hub, writeTimeout)
+	}
+}
+
+func serveConn(conn net.Conn, hub *Hub, writeTimeout time.Duration) {
+	defer conn.Close()
+
+	s := hub.Subscribe()
+	defer s.Close()
+
+	// Clients are not expected to send anything, so reading only returns when the client closes the connection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+
+		buf := make([]byte, 512)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case telegram, ok := <-s.Telegrams():
+			if !ok {
+				return
+			}
+
+			if writeTimeout > 0 {
+				if err := conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+					return
+				}
+			}
+
+			if _, err := conn.Write(telegram.Raw); err != nil {
+				log.Printf("Closing connection of %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package expose
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+)
+
+type TLSOptions struct {
+	CertFile     string `env:"EXPOSE_TLS_CERT_FILE" flag:"cert-file" desc:"PEM encoded server certificate, set to enable TLS"`
+	KeyFile      string `env:"EXPOSE_TLS_KEY_FILE" flag:"key-file" desc:"PEM encoded key of the server certificate"`
+	ClientCAFile string `env:"EXPOSE_TLS_CLIENT_CA_FILE" flag:"client-ca-file" desc:"PEM encoded CA certificate that client certificates must be signed by, set to require client certificates"`
+}
+
+// NewTLSConfig returns the TLS configuration of the server, or nil if TLS is not enabled.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if opts.CertFile == "" {
+		if opts.KeyFile != "" || opts.ClientCAFile != "" {
+			return nil, fmt.Errorf("a server certificate is required for TLS")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if opts.ClientCAFile != "" {
+		ca, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA certificate: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.ClientCAFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// Listen listens on the TCP address, only accepting connections from clients in one of the CIDRs if any are given and
+// using TLS if tlsConfig is not nil.
+func Listen(addr string, allowedCIDRs []string, tlsConfig *tls.Config) (net.Listener, error) {
+	prefixes := make([]netip.Prefix, 0, len(allowedCIDRs))
+	for _, cidr := range allowedCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on address %v: %w", addr, err)
+	}
+
+	if len(prefixes) > 0 {
+		l = &allowListListener{
+			Listener: l,
+			prefixes: prefixes,
+		}
+	}
+
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	return l, nil
+}
+
+// allowListListener closes connections from addresses that are not in any of the prefixes, before the TLS handshake.
+type allowListListener struct {
+	net.Listener
+	prefixes []netip.Prefix
+}
+
+func (l *allowListListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if l.allowed(conn.RemoteAddr()) {
+			return conn, nil
+		}
+
+		log.Printf("Rejected connection of %s, which is not in the allowed CIDRs", conn.RemoteAddr())
+		conn.Close()
+	}
+}
+
+func (l *allowListListener) allowed(addr net.Addr) bool {
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+
+	// IPv4 clients of a dual-stack listener have an IPv4-mapped IPv6 address
+	ip := addrPort.Addr().Unmap()
+
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
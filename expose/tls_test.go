@@ -0,0 +1,160 @@
+package expose_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/koesie10/smartmeter/expose"
+	"github.com/koesie10/smartmeter/serialinput"
+	"github.com/koesie10/smartmeter/smartmeter"
+)
+
+func TestTLS(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	ca, caKey := writeCertificate(t, dir, "ca", nil, nil)
+	writeCertificate(t, dir, "server", ca, caKey)
+	writeCertificate(t, dir, "client", ca, caKey)
+
+	tlsConfig, err := expose.NewTLSConfig(expose.TLSOptions{
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server-key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := expose.Listen("127.0.0.1:0", []string{"127.0.0.0/8"}, tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	hub := expose.NewHub(10)
+	hub.Publish(expose.Telegram{Raw: raw})
+	go expose.Serve(l, hub, time.Second)
+
+	options := &serialinput.NetworkOptions{
+		Type:        "tcp",
+		Address:     l.Addr().String(),
+		DialTimeout: time.Second,
+		ReadTimeout: time.Second,
+
+		TLS:         true,
+		TLSCAFile:   filepath.Join(dir, "ca.pem"),
+		TLSCertFile: filepath.Join(dir, "client.pem"),
+		TLSKeyFile:  filepath.Join(dir, "client-key.pem"),
+	}
+
+	r, err := serialinput.OpenNetwork(options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	sm, err := smartmeter.New(r, smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a client certificate, the server rejects the connection
+	options.TLSCertFile = ""
+	options.TLSKeyFile = ""
+	r, err = serialinput.OpenNetwork(options, nil)
+	if err == nil {
+		_, err = r.Read(make([]byte, 1))
+		r.Close()
+	}
+	if err == nil {
+		t.Errorf("expected an error without a client certificate")
+	}
+
+	// Clients outside of the allowed CIDRs are rejected before the handshake
+	denied, err := expose.Listen("127.0.0.1:0", []string{"192.0.2.0/24"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer denied.Close()
+	go expose.Serve(denied, hub, time.Second)
+
+	conn, err := net.Dial("tcp", denied.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if n, _ := conn.Read(make([]byte, 1)); n != 0 {
+		t.Errorf("expected the connection to be closed for a client outside of the allowed CIDRs")
+	}
+}
+
+// writeCertificate writes a certificate and key to name.pem and name-key.pem in dir, which is a CA certificate if parent
+// is nil and a certificate for 127.0.0.1 signed by parent otherwise.
+func writeCertificate(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	} else {
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
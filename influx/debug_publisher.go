@@ -13,6 +13,9 @@ type debugPublisher struct {
 	options DebugPublisherOptions
 
 	tags map[string]string
+
+	// lastMessage is the last text message that was written, so it is only written when it changes
+	lastMessage smartmeter.Message
 }
 
 func NewDebugPublisher(options DebugPublisherOptions) (smartmeter.Publisher, error) {
@@ -25,7 +28,11 @@ func NewDebugPublisher(options DebugPublisherOptions) (smartmeter.Publisher, err
 type DebugPublisherOptions struct {
 	ElectricityMeasurementName string `env:"INFLUX_ELECTRICITY_MEASUREMENT_NAME" flag:"electricity-measurement-name" desc:"InfluxDB electricity measurement name"`
 	PhaseMeasurementName       string `env:"INFLUX_PHASE_MEASUREMENT_NAME" flag:"phase-measurement-name" desc:"InfluxDB phase measurement name"`
-	GasMeasurementName         string `env:"INFLUX_GAS_PHASE_NAME" flag:"gas-measurement-name" desc:"InfluxDB gas measurement name"`
+	GasMeasurementName         string `env:"INFLUX_GAS_PHASE_NAME" flag:"gas-measurement-name" desc:"InfluxDB gas measurement name, which is kept for backwards compatibility since the gas meter is also written to the M-Bus measurement"`
+	MBusMeasurementName        string `env:"INFLUX_MBUS_MEASUREMENT_NAME" flag:"mbus-measurement-name" desc:"InfluxDB M-Bus measurement name"`
+
+	MaximumDemandMeasurementName string `env:"INFLUX_MAXIMUM_DEMAND_MEASUREMENT_NAME" flag:"maximum-demand-measurement-name" desc:"InfluxDB maximum demand history measurement name"`
+	MessageMeasurementName       string `env:"INFLUX_MESSAGE_MEASUREMENT_NAME" flag:"message-measurement-name" desc:"InfluxDB text message measurement name"`
 }
 
 func (p *debugPublisher) Publish(packet *smartmeter.P1Packet) error {
@@ -45,12 +52,45 @@ func (p *debugPublisher) Publish(packet *smartmeter.P1Packet) error {
 		fmt.Printf("INFLUX DEBUG: %s", write.PointToLineProtocol(phasePoint, time.Millisecond))
 	}
 
-	gasPoint, err := NewGasPoint(packet, p.options.GasMeasurementName, p.tags)
-	if err != nil {
-		return fmt.Errorf("failed to create gas point: %w", err)
+	if !packet.Gas.MeasuredAt.IsZero() {
+		gasPoint, err := NewGasPoint(packet, p.options.GasMeasurementName, p.tags)
+		if err != nil {
+			return fmt.Errorf("failed to create gas point: %w", err)
+		}
+
+		fmt.Printf("INFLUX DEBUG: %s", write.PointToLineProtocol(gasPoint, time.Millisecond))
+	}
+
+	for i := range packet.MBus {
+		mbusPoint, err := NewMBusPoint(packet, i, p.options.MBusMeasurementName, p.tags)
+		if err != nil {
+			return fmt.Errorf("failed to create M-Bus point: %w", err)
+		}
+
+		fmt.Printf("INFLUX DEBUG: %s", write.PointToLineProtocol(mbusPoint, time.Millisecond))
+	}
+
+	if packet.Electricity.CapacityTariff != nil {
+		for _, demand := range packet.Electricity.CapacityTariff.RecordedHistory() {
+			maximumDemandPoint, err := NewMaximumDemandPoint(packet, demand, p.options.MaximumDemandMeasurementName, p.tags)
+			if err != nil {
+				return fmt.Errorf("failed to create maximum demand point: %w", err)
+			}
+
+			fmt.Printf("INFLUX DEBUG: %s", write.PointToLineProtocol(maximumDemandPoint, time.Millisecond))
+		}
 	}
 
-	fmt.Printf("INFLUX DEBUG: %s", write.PointToLineProtocol(gasPoint, time.Millisecond))
+	if packet.Message != p.lastMessage {
+		messagePoint, err := NewMessagePoint(time.Now(), packet, p.options.MessageMeasurementName, p.tags)
+		if err != nil {
+			return fmt.Errorf("failed to create message point: %w", err)
+		}
+
+		fmt.Printf("INFLUX DEBUG: %s", write.PointToLineProtocol(messagePoint, time.Millisecond))
+
+		p.lastMessage = packet.Message
+	}
 
 	return nil
 }
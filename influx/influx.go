@@ -1,6 +1,7 @@
 package influx
 
 import (
+	"fmt"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"strconv"
@@ -18,10 +19,10 @@ func NewElectricityPoint(t time.Time, p *smartmeter.P1Packet, measurementName st
 	fields := make(map[string]interface{})
 	fields["threshold"] = p.Electricity.Threshold
 
-	fields["tariff1_consumed"] = p.Electricity.Tariffs[0].Consumed
-	fields["tariff1_produced"] = p.Electricity.Tariffs[0].Produced
-	fields["tariff2_consumed"] = p.Electricity.Tariffs[1].Consumed
-	fields["tariff2_produced"] = p.Electricity.Tariffs[1].Produced
+	for _, tariff := range p.Electricity.Tariffs {
+		fields[fmt.Sprintf("tariff%d_consumed", tariff.Number)] = tariff.Consumed
+		fields[fmt.Sprintf("tariff%d_produced", tariff.Number)] = tariff.Produced
+	}
 
 	fields["current_consumed"] = p.Electricity.CurrentConsumed
 	fields["current_produced"] = p.Electricity.CurrentProduced
@@ -29,6 +30,11 @@ func NewElectricityPoint(t time.Time, p *smartmeter.P1Packet, measurementName st
 	fields["number_of_power_failures"] = p.Electricity.NumberOfPowerFailures
 	fields["number_of_long_power_failures"] = p.Electricity.NumberOfLongPowerFailures
 
+	if c := p.Electricity.CapacityTariff; c != nil {
+		fields["current_average_demand"] = c.CurrentAverageDemand
+		fields["maximum_demand"] = c.MaximumDemand.Value
+	}
+
 	return influxdb2.NewPoint(measurementName, tags, fields, t), nil
 }
 
@@ -37,12 +43,10 @@ func NewPhasePoint(t time.Time, p *smartmeter.P1Packet, phase int, measurementNa
 	tags["equipment_id"] = p.Electricity.EquipmentID
 	tags["tariff"] = strconv.Itoa(p.Electricity.Tariff)
 	tags["switch_position"] = strconv.Itoa(p.Electricity.SwitchPosition)
-	// Our phases are 0-indexed in the slice, while they are named in a 1-index fashion.
-	// We will use the 1-indexed tags
-	tags["phase"] = strconv.Itoa(phase + 1)
-
 	pp := p.Electricity.Phases[phase]
 
+	tags["phase"] = strconv.Itoa(pp.Number)
+
 	fields := make(map[string]interface{})
 	fields["number_of_voltage_sags"] = pp.NumberOfVoltageSags
 	fields["number_of_voltage_swells"] = pp.NumberOfVoltageSwells
@@ -55,6 +59,8 @@ func NewPhasePoint(t time.Time, p *smartmeter.P1Packet, phase int, measurementNa
 	return influxdb2.NewPoint(measurementName, tags, fields, t), nil
 }
 
+// NewGasPoint creates a point for the gas meter at the time of its last reading. It is the same reading as the M-Bus
+// point of the gas meter, but is kept for backwards compatibility with existing queries.
 func NewGasPoint(p *smartmeter.P1Packet, measurementName string, tags map[string]string) (*write.Point, error) {
 	tags = copyTags(tags)
 	tags["equipment_id"] = p.Gas.EquipmentID
@@ -67,10 +73,50 @@ func NewGasPoint(p *smartmeter.P1Packet, measurementName string, tags map[string
 	return influxdb2.NewPoint(measurementName, tags, fields, p.Gas.MeasuredAt), nil
 }
 
+// NewMessagePoint creates an event point for the text message of the meter, which should only be written when the
+// message changes.
+func NewMessagePoint(t time.Time, p *smartmeter.P1Packet, measurementName string, tags map[string]string) (*write.Point, error) {
+	tags = copyTags(tags)
+	tags["equipment_id"] = p.Electricity.EquipmentID
+
+	fields := make(map[string]interface{})
+	fields["code"] = p.Message.Code
+	fields["text"] = p.Message.Text
+
+	return influxdb2.NewPoint(measurementName, tags, fields, t), nil
+}
+
+// NewMaximumDemandPoint creates a point for a month of the maximum demand history of the capacity tariff, at the time
+// the maximum demand was reached. Months without a recorded demand should be skipped, see
+// smartmeter.CapacityTariff.RecordedHistory.
+func NewMaximumDemandPoint(p *smartmeter.P1Packet, d smartmeter.MonthlyDemand, measurementName string, tags map[string]string) (*write.Point, error) {
+	tags = copyTags(tags)
+	tags["equipment_id"] = p.Electricity.EquipmentID
+
+	fields := make(map[string]interface{})
+	fields["value"] = d.Value
+
+	return influxdb2.NewPoint(measurementName, tags, fields, d.Timestamp), nil
+}
+
+func NewMBusPoint(p *smartmeter.P1Packet, device int, measurementName string, tags map[string]string) (*write.Point, error) {
+	d := p.MBus[device]
+
+	tags = copyTags(tags)
+	tags["equipment_id"] = d.EquipmentID
+	tags["channel"] = strconv.Itoa(d.Channel)
+	tags["device_type"] = strconv.Itoa(d.DeviceType)
+	tags["kind"] = d.Kind()
+	tags["unit"] = d.Unit
+	tags["valve_position"] = strconv.Itoa(d.ValvePosition)
+
+	fields := make(map[string]interface{})
+	fields["value"] = d.Value
+
+	return influxdb2.NewPoint(measurementName, tags, fields, d.MeasuredAt), nil
+}
+
 func copyTags(tags map[string]string) map[string]string {
-	if len(tags) == 0 {
-		return tags
-	}
 	result := make(map[string]string, len(tags))
 	for k, v := range tags {
 		result[k] = v
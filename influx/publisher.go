@@ -17,6 +17,9 @@ type publisher struct {
 
 	options PublisherOptions
 	tags    map[string]string
+
+	// lastMessage is the last text message that was written, so it is only written when it changes
+	lastMessage smartmeter.Message
 }
 
 func NewPublisher(options PublisherOptions) (smartmeter.Publisher, error) {
@@ -53,7 +56,11 @@ type PublisherOptions struct {
 
 	ElectricityMeasurementName string `env:"INFLUX_ELECTRICITY_MEASUREMENT_NAME" flag:"electricity-measurement-name" desc:"InfluxDB electricity measurement name"`
 	PhaseMeasurementName       string `env:"INFLUX_PHASE_MEASUREMENT_NAME" flag:"phase-measurement-name" desc:"InfluxDB phase measurement name"`
-	GasMeasurementName         string `env:"INFLUX_GAS_PHASE_NAME" flag:"gas-measurement-name" desc:"InfluxDB gas measurement name"`
+	GasMeasurementName         string `env:"INFLUX_GAS_PHASE_NAME" flag:"gas-measurement-name" desc:"InfluxDB gas measurement name, which is kept for backwards compatibility since the gas meter is also written to the M-Bus measurement"`
+	MBusMeasurementName        string `env:"INFLUX_MBUS_MEASUREMENT_NAME" flag:"mbus-measurement-name" desc:"InfluxDB M-Bus measurement name"`
+
+	MaximumDemandMeasurementName string `env:"INFLUX_MAXIMUM_DEMAND_MEASUREMENT_NAME" flag:"maximum-demand-measurement-name" desc:"InfluxDB maximum demand history measurement name"`
+	MessageMeasurementName       string `env:"INFLUX_MESSAGE_MEASUREMENT_NAME" flag:"message-measurement-name" desc:"InfluxDB text message measurement name"`
 
 	Tags []string `env:"INFLUX_TAGS" flag:"tags" desc:"InfluxDB tags in key=value format"`
 
@@ -77,12 +84,46 @@ func (p *publisher) Publish(packet *smartmeter.P1Packet) error {
 		p.writeAPI.WritePoint(phasePoint)
 	}
 
-	gasPoint, err := NewGasPoint(packet, p.options.GasMeasurementName, p.tags)
-	if err != nil {
-		return fmt.Errorf("failed to create gas point: %w", err)
+	// The gas point is skipped when there is no gas reading, since its time would be the zero time
+	if !packet.Gas.MeasuredAt.IsZero() {
+		gasPoint, err := NewGasPoint(packet, p.options.GasMeasurementName, p.tags)
+		if err != nil {
+			return fmt.Errorf("failed to create gas point: %w", err)
+		}
+
+		p.writeAPI.WritePoint(gasPoint)
+	}
+
+	for i := range packet.MBus {
+		mbusPoint, err := NewMBusPoint(packet, i, p.options.MBusMeasurementName, p.tags)
+		if err != nil {
+			return fmt.Errorf("failed to create M-Bus point: %w", err)
+		}
+
+		p.writeAPI.WritePoint(mbusPoint)
+	}
+
+	if packet.Electricity.CapacityTariff != nil {
+		for _, demand := range packet.Electricity.CapacityTariff.RecordedHistory() {
+			maximumDemandPoint, err := NewMaximumDemandPoint(packet, demand, p.options.MaximumDemandMeasurementName, p.tags)
+			if err != nil {
+				return fmt.Errorf("failed to create maximum demand point: %w", err)
+			}
+
+			p.writeAPI.WritePoint(maximumDemandPoint)
+		}
 	}
 
-	p.writeAPI.WritePoint(gasPoint)
+	if packet.Message != p.lastMessage {
+		messagePoint, err := NewMessagePoint(time.Now(), packet, p.options.MessageMeasurementName, p.tags)
+		if err != nil {
+			return fmt.Errorf("failed to create message point: %w", err)
+		}
+
+		p.writeAPI.WritePoint(messagePoint)
+
+		p.lastMessage = packet.Message
+	}
 
 	return nil
 }
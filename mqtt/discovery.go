@@ -3,6 +3,9 @@ package mqtt
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+
+	"github.com/koesie10/smartmeter/smartmeter"
 
 	"go.uber.org/zap"
 )
@@ -38,6 +41,10 @@ func (p *publisher) publishDiscovery() error {
 		return nil
 	}
 
+	p.mu.Lock()
+	packet := p.lastPacket
+	p.mu.Unlock()
+
 	discovery := homeAssistantDiscovery{
 		p: p,
 		Device: &homeAssistantDevice{
@@ -48,38 +55,61 @@ func (p *publisher) publishDiscovery() error {
 		},
 	}
 
-	entities := discovery.configureEntities()
+	// Report the meter from the telegram header, unless the user has configured the manufacturer or model
+	if packet != nil {
+		if discovery.Device.Manufacturer == "" {
+			discovery.Device.Manufacturer = packet.Header.Manufacturer()
+		}
+		if discovery.Device.Model == "" {
+			discovery.Device.Model = packet.Header.Identification
+		}
+	}
+
+	entities := discovery.configureEntities(packet)
 	for _, entity := range entities {
 		if err := discovery.publishEntity(entity); err != nil {
 			p.logger.With(zap.Error(err)).Warnf("Failed to publish entity %s", entity.InternalID)
 		}
 	}
 
+	for _, id := range removedEntities(entities) {
+		discovery.removeEntity(id)
+	}
+
 	return nil
 }
 
 func (d *homeAssistantDiscovery) publishEntity(entity *homeAssistantEntity) error {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config to JSON: %w", err)
+	}
+
+	d.publishConfig(entity.InternalID, string(data))
+
+	return nil
+}
+
+// removeEntity publishes an empty config for the entity, which makes Home Assistant remove it.
+func (d *homeAssistantDiscovery) removeEntity(id string) {
+	d.publishConfig(id, "")
+}
+
+func (d *homeAssistantDiscovery) publishConfig(id string, config string) {
 	topic := fmt.Sprintf(
 		"%s/sensor/%s%s/config",
 		d.p.options.HomeAssistant.DiscoveryPrefix,
 		d.p.options.HomeAssistant.DevicePrefix,
-		entity.InternalID,
+		id,
 	)
 
-	data, err := json.Marshal(entity)
-	if err != nil {
-		return fmt.Errorf("failed to marshal config to JSON: %w", err)
-	}
-
-	token := d.p.client.Publish(topic, byte(d.p.options.HomeAssistant.DiscoveryQoS), true, string(data))
+	token := d.p.client.Publish(topic, byte(d.p.options.HomeAssistant.DiscoveryQoS), true, config)
 	go func(topic string) {
 		token.Wait()
 		if err := token.Error(); err != nil {
 			d.p.logger.With(zap.Error(err)).Warnf("Failed to publish config %s to MQTT", topic)
 		}
 	}(topic)
-
-	return nil
 }
 
 func (d *homeAssistantDiscovery) configureEntity(id string, config *homeAssistantEntity) *homeAssistantEntity {
@@ -91,3 +121,27 @@ func (d *homeAssistantDiscovery) configureEntity(id string, config *homeAssistan
 
 	return config
 }
+
+// discoveryKey returns a key describing the entities that are needed for the packet, so discovery messages can be
+// published again when the devices of the meter change.
+func discoveryKey(packet *smartmeter.P1Packet) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "header:%s;", packet.Header.ManufacturerID+packet.Header.Identification)
+	for _, tariff := range packet.Electricity.Tariffs {
+		fmt.Fprintf(&b, "tariff%d;", tariff.Number)
+	}
+	for _, phase := range packet.Electricity.Phases {
+		fmt.Fprintf(&b, "phase%d;", phase.Number)
+	}
+
+	if packet.Electricity.CapacityTariff != nil {
+		b.WriteString("capacity;")
+	}
+
+	for _, device := range packet.MBus {
+		fmt.Fprintf(&b, "mbus%d:%d:%s;", device.Channel, device.DeviceType, device.Unit)
+	}
+
+	return b.String()
+}
@@ -1,9 +1,15 @@
 package mqtt
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/koesie10/smartmeter/smartmeter"
+)
 
 // https://developers.home-assistant.io/docs/core/entity/sensor/#long-term-statistics
-func (d *homeAssistantDiscovery) configureEntities() []*homeAssistantEntity {
+// The packet is the last received packet, which is used to configure the entities of devices that are not present on
+// every meter. It is nil if no packet has been received yet.
+func (d *homeAssistantDiscovery) configureEntities(packet *smartmeter.P1Packet) []*homeAssistantEntity {
 	var result []*homeAssistantEntity
 
 	result = append(result,
@@ -13,22 +19,29 @@ func (d *homeAssistantDiscovery) configureEntities() []*homeAssistantEntity {
 		}),
 	)
 
-	for tariff := 0; tariff < 2; tariff++ {
+	var tariffs []smartmeter.Tariff
+	var phases []smartmeter.Phase
+	if packet != nil {
+		tariffs = packet.Electricity.Tariffs
+		phases = packet.Electricity.Phases
+	}
+
+	for i, tariff := range tariffs {
 		result = append(
 			result,
-			d.configureEntity(fmt.Sprintf("tariff%d_consumed", tariff+1), &homeAssistantEntity{
+			d.configureEntity(tariffEntityID(tariff.Number, "consumed"), &homeAssistantEntity{
 				DeviceClass:       "energy",
-				Name:              fmt.Sprintf("Energy Consumption (tariff %d)", tariff+1),
+				Name:              fmt.Sprintf("Energy Consumption (tariff %d)", tariff.Number),
 				StateClass:        "total",
 				UnitOfMeasurement: "kWh",
-				ValueTemplate:     fmt.Sprintf("{{ value_json.Electricity.Tariffs[%d].Consumed }}", tariff),
+				ValueTemplate:     fmt.Sprintf("{{ value_json.Electricity.Tariffs[%d].Consumed }}", i),
 			}),
-			d.configureEntity(fmt.Sprintf("tariff%d_produced", tariff+1), &homeAssistantEntity{
+			d.configureEntity(tariffEntityID(tariff.Number, "produced"), &homeAssistantEntity{
 				DeviceClass:       "energy",
-				Name:              fmt.Sprintf("Energy Production (tariff %d)", tariff+1),
+				Name:              fmt.Sprintf("Energy Production (tariff %d)", tariff.Number),
 				StateClass:        "total",
 				UnitOfMeasurement: "kWh",
-				ValueTemplate:     fmt.Sprintf("{{ value_json.Electricity.Tariffs[%d].Produced }}", tariff),
+				ValueTemplate:     fmt.Sprintf("{{ value_json.Electricity.Tariffs[%d].Produced }}", i),
 			}),
 		)
 	}
@@ -55,22 +68,22 @@ func (d *homeAssistantDiscovery) configureEntities() []*homeAssistantEntity {
 		}),
 	)
 
-	for phase := 0; phase < 3; phase++ {
+	for i, phase := range phases {
 		result = append(
 			result,
-			d.configureEntity(fmt.Sprintf("phase%d_instantaneous_voltage", phase+1), &homeAssistantEntity{
+			d.configureEntity(phaseEntityID(phase.Number, "instantaneous_voltage"), &homeAssistantEntity{
 				DeviceClass:       "voltage",
-				Name:              fmt.Sprintf("Instantaneous voltage (phase %d)", phase+1),
+				Name:              fmt.Sprintf("Instantaneous voltage (phase %d)", phase.Number),
 				StateClass:        "measurement",
 				UnitOfMeasurement: "V",
-				ValueTemplate:     fmt.Sprintf("{{ value_json.Electricity.Phases[%d].InstantaneousVoltage }}", phase),
+				ValueTemplate:     fmt.Sprintf("{{ value_json.Electricity.Phases[%d].InstantaneousVoltage }}", i),
 			}),
-			d.configureEntity(fmt.Sprintf("phase%d_instantaneous_current", phase+1), &homeAssistantEntity{
+			d.configureEntity(phaseEntityID(phase.Number, "instantaneous_current"), &homeAssistantEntity{
 				DeviceClass:       "current",
-				Name:              fmt.Sprintf("Instantaneous current (phase %d)", phase+1),
+				Name:              fmt.Sprintf("Instantaneous current (phase %d)", phase.Number),
 				StateClass:        "measurement",
 				UnitOfMeasurement: "A",
-				ValueTemplate:     fmt.Sprintf("{{ value_json.Electricity.Phases[%d].InstantaneousCurrent }}", phase),
+				ValueTemplate:     fmt.Sprintf("{{ value_json.Electricity.Phases[%d].InstantaneousCurrent }}", i),
 			}),
 		)
 	}
@@ -90,5 +103,125 @@ func (d *homeAssistantDiscovery) configureEntities() []*homeAssistantEntity {
 		}),
 	)
 
+	result = append(result,
+		d.configureEntity("message_code", &homeAssistantEntity{
+			Name:          "Message Code",
+			ValueTemplate: "{{ value_json.Message.Code }}",
+		}),
+		d.configureEntity("message_text", &homeAssistantEntity{
+			Name:          "Message",
+			ValueTemplate: "{{ value_json.Message.Text }}",
+		}),
+	)
+
+	if packet != nil && packet.Electricity.CapacityTariff != nil {
+		result = append(result,
+			d.configureEntity("current_average_demand", &homeAssistantEntity{
+				DeviceClass:       "power",
+				Name:              "Current Average Demand",
+				StateClass:        "measurement",
+				UnitOfMeasurement: "kW",
+				ValueTemplate:     "{{ value_json.Electricity.CapacityTariff.CurrentAverageDemand }}",
+			}),
+			d.configureEntity("maximum_demand", &homeAssistantEntity{
+				DeviceClass:       "power",
+				Name:              "Maximum Demand (current month)",
+				StateClass:        "measurement",
+				UnitOfMeasurement: "kW",
+				ValueTemplate:     "{{ value_json.Electricity.CapacityTariff.MaximumDemand.Value }}",
+			}),
+		)
+	}
+
+	if packet != nil {
+		for i, device := range packet.MBus {
+			// The gas meter is already configured by the gas entities
+			if device.Channel == packet.Gas.Channel {
+				continue
+			}
+
+			result = append(result, d.configureMBusEntity(i, device))
+		}
+	}
+
+	return result
+}
+
+// removedEntities returns the IDs of the entities that are only configured for some packets and are not configured for
+// this packet, so entities of tariffs, phases and devices that are no longer reported by the meter, or M-Bus devices
+// that are now covered by the gas entities, are removed.
+func removedEntities(entities []*homeAssistantEntity) []string {
+	configured := make(map[string]bool, len(entities))
+	for _, entity := range entities {
+		configured[entity.InternalID] = true
+	}
+
+	var result []string
+	for _, id := range optionalEntityIDs() {
+		if !configured[id] {
+			result = append(result, id)
+		}
+	}
+
 	return result
 }
+
+// optionalEntityIDs returns the IDs of all entities that are only configured when they are present in the packet.
+func optionalEntityIDs() []string {
+	var result []string
+
+	for number := 0; number <= smartmeter.MaxTariffs; number++ {
+		result = append(result, tariffEntityID(number, "consumed"), tariffEntityID(number, "produced"))
+	}
+	for number := 1; number <= smartmeter.MaxPhases; number++ {
+		result = append(result, phaseEntityID(number, "instantaneous_voltage"), phaseEntityID(number, "instantaneous_current"))
+	}
+
+	result = append(result, "current_average_demand", "maximum_demand")
+
+	for channel := 1; channel <= smartmeter.MBusChannels; channel++ {
+		result = append(result, mbusEntityID(channel))
+	}
+
+	return result
+}
+
+func tariffEntityID(number int, quantity string) string {
+	return fmt.Sprintf("tariff%d_%s", number, quantity)
+}
+
+func phaseEntityID(number int, quantity string) string {
+	return fmt.Sprintf("phase%d_%s", number, quantity)
+}
+
+func mbusEntityID(channel int) string {
+	return fmt.Sprintf("mbus%d_value", channel)
+}
+
+func (d *homeAssistantDiscovery) configureMBusEntity(index int, device smartmeter.MBusDevice) *homeAssistantEntity {
+	entity := &homeAssistantEntity{
+		StateClass:        "total",
+		UnitOfMeasurement: device.Unit,
+		ValueTemplate:     fmt.Sprintf("{{ value_json.MBus[%d].Value }}", index),
+	}
+
+	switch device.Kind() {
+	case "gas":
+		entity.DeviceClass = "gas"
+		entity.Name = fmt.Sprintf("Gas Consumed (channel %d)", device.Channel)
+	case "water", "warm_water":
+		entity.DeviceClass = "water"
+		entity.Name = fmt.Sprintf("Water Consumed (channel %d)", device.Channel)
+	case "heat":
+		entity.DeviceClass = "energy"
+		entity.Name = fmt.Sprintf("Heat Consumed (channel %d)", device.Channel)
+	default:
+		entity.Name = fmt.Sprintf("M-Bus Reading (channel %d)", device.Channel)
+	}
+
+	if entity.UnitOfMeasurement == "m3" {
+		entity.UnitOfMeasurement = "m³"
+	}
+
+	return d.configureEntity(mbusEntityID(device.Channel), entity)
+}
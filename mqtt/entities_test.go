@@ -0,0 +1,48 @@
+package mqtt
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/koesie10/smartmeter/smartmeter"
+)
+
+func TestRemovedEntities(t *testing.T) {
+	d := &homeAssistantDiscovery{
+		p: &publisher{},
+	}
+
+	packet := &smartmeter.P1Packet{}
+	packet.Electricity.Tariffs = []smartmeter.Tariff{{Number: 1}, {Number: 2}}
+	packet.Electricity.Phases = []smartmeter.Phase{{Number: 1}, {Number: 2}, {Number: 3}}
+	packet.Electricity.CapacityTariff = &smartmeter.CapacityTariff{}
+
+	removed := removedEntities(d.configureEntities(packet))
+	for _, id := range []string{"tariff1_consumed", "tariff2_produced", "phase3_instantaneous_voltage", "current_average_demand"} {
+		if slices.Contains(removed, id) {
+			t.Errorf("expected configured entity %s not to be removed", id)
+		}
+	}
+	for _, id := range []string{"tariff0_consumed", "tariff3_consumed", "mbus1_value"} {
+		if !slices.Contains(removed, id) {
+			t.Errorf("expected entity %s to be removed", id)
+		}
+	}
+
+	// After the meter is replaced by a single phase meter without capacity tariff, the entities of the other phases
+	// and the capacity tariff are removed
+	packet.Electricity.Phases = packet.Electricity.Phases[:1]
+	packet.Electricity.CapacityTariff = nil
+
+	removed = removedEntities(d.configureEntities(packet))
+	for _, id := range []string{"phase2_instantaneous_voltage", "phase2_instantaneous_current", "phase3_instantaneous_voltage", "phase3_instantaneous_current", "current_average_demand", "maximum_demand"} {
+		if !slices.Contains(removed, id) {
+			t.Errorf("expected entity %s to be removed", id)
+		}
+	}
+	for _, id := range []string{"phase1_instantaneous_voltage", "phase1_instantaneous_current", "tariff1_consumed"} {
+		if slices.Contains(removed, id) {
+			t.Errorf("expected configured entity %s not to be removed", id)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/koesie10/smartmeter/smartmeter"
 	"go.uber.org/zap"
 	"os"
+	"sync"
 	"time"
 
 	mqttclient "github.com/eclipse/paho.mqtt.golang"
@@ -19,6 +20,12 @@ type publisher struct {
 
 	options PublisherOptions
 
+	// mu protects lastPacket and discoveryKey, which are used to publish discovery messages for the devices that are
+	// actually present in the packets
+	mu           sync.Mutex
+	lastPacket   *smartmeter.P1Packet
+	discoveryKey string
+
 	done chan struct{}
 }
 
@@ -97,6 +104,19 @@ func (p *publisher) Publish(packet *smartmeter.P1Packet) error {
 		return fmt.Errorf("failed to marshal observation to JSON: %w", err)
 	}
 
+	p.mu.Lock()
+	p.lastPacket = packet
+	key := discoveryKey(packet)
+	discoveryChanged := key != p.discoveryKey
+	p.discoveryKey = key
+	p.mu.Unlock()
+
+	if discoveryChanged {
+		if err := p.publishDiscovery(); err != nil {
+			p.logger.With(zap.Error(err)).Warnf("Failed to publish discovery message")
+		}
+	}
+
 	token := p.client.Publish(p.options.Topic, byte(p.options.QoS), true, string(data))
 	go func() {
 		token.Wait()
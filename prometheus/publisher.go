@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/koesie10/smartmeter/smartmeter"
@@ -21,6 +22,10 @@ type publisher struct {
 
 	server *http.Server
 
+	meterInfo *prometheus.GaugeVec
+	// meterInfoLabels are the label values of the current meter info, so the series can be removed when they change
+	meterInfoLabels []string
+
 	threshold       *prometheus.GaugeVec
 	currentConsumed prometheus.Gauge
 	currentProduced prometheus.Gauge
@@ -28,6 +33,11 @@ type publisher struct {
 	numberOfPowerFailures     prometheus.Gauge
 	numberOfLongPowerFailures prometheus.Gauge
 
+	currentAverageDemand          prometheus.Gauge
+	maximumDemand                 prometheus.Gauge
+	maximumDemandTimestampSeconds prometheus.Gauge
+	maximumDemandHistory          *prometheus.GaugeVec
+
 	tariffConsumed *prometheus.GaugeVec
 	tariffProduced *prometheus.GaugeVec
 
@@ -40,15 +50,27 @@ type publisher struct {
 	instantaneousActiveNegativePower *prometheus.GaugeVec
 
 	gasConsumed prometheus.Gauge
+
+	mbusValue *prometheus.GaugeVec
 }
 
-func NewPublisher(options PublisherOptions) (smartmeter.Publisher, error) {
+// NewPublisher serves the metrics of the published packets, together with the extra collectors, such as metrics of the
+// input.
+func NewPublisher(options PublisherOptions, extraCollectors ...prometheus.Collector) (smartmeter.Publisher, error) {
 	p := &publisher{
 		options: options,
 	}
 
 	registry := prometheus.NewRegistry()
 
+	p.meterInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "meter_info",
+		Help:      "Information about the meter from the telegram header",
+		Namespace: "smartmeter",
+	}, []string{"manufacturer_id", "manufacturer", "identification", "equipment_id", "dsmr_version"})
+
+	registry.MustRegister(p.meterInfo)
+
 	p.threshold = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name:      "threshold",
 		Help:      "Actual electricity threshold in the unit specified by the tags",
@@ -84,6 +106,33 @@ func NewPublisher(options PublisherOptions) (smartmeter.Publisher, error) {
 
 	registry.MustRegister(p.threshold, p.currentConsumed, p.currentProduced, p.numberOfPowerFailures, p.numberOfLongPowerFailures)
 
+	p.currentAverageDemand = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "current_average_demand",
+		Help:      "Average demand of the current quarter-hour in kW",
+		Subsystem: "electricity",
+		Namespace: "smartmeter",
+	})
+	p.maximumDemand = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "maximum_demand",
+		Help:      "Highest quarter-hour average demand of the current month in kW",
+		Subsystem: "electricity",
+		Namespace: "smartmeter",
+	})
+	p.maximumDemandTimestampSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "maximum_demand_timestamp_seconds",
+		Help:      "Time at which the highest quarter-hour average demand of the current month was reached",
+		Subsystem: "electricity",
+		Namespace: "smartmeter",
+	})
+	p.maximumDemandHistory = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "maximum_demand_history",
+		Help:      "Highest quarter-hour average demand of the month in kW",
+		Subsystem: "electricity",
+		Namespace: "smartmeter",
+	}, []string{"month"})
+
+	registry.MustRegister(p.currentAverageDemand, p.maximumDemand, p.maximumDemandTimestampSeconds, p.maximumDemandHistory)
+
 	p.tariffConsumed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name:      "tariff_consumed",
 		Help:      "Electricity delivered to client in kWh",
@@ -149,6 +198,17 @@ func NewPublisher(options PublisherOptions) (smartmeter.Publisher, error) {
 
 	registry.MustRegister(p.gasConsumed)
 
+	p.mbusValue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "value",
+		Help:      "Last reading of the M-Bus device in the unit specified by the tags",
+		Subsystem: "mbus",
+		Namespace: "smartmeter",
+	}, []string{"channel", "device_type", "kind", "unit"})
+
+	registry.MustRegister(p.mbusValue)
+
+	registry.MustRegister(extraCollectors...)
+
 	if !options.DisableGoCollector {
 		registry.MustRegister(collectors.NewGoCollector())
 		registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
@@ -197,6 +257,8 @@ type PublisherOptions struct {
 }
 
 func (p *publisher) Publish(packet *smartmeter.P1Packet) error {
+	p.publishMeterInfo(packet)
+
 	p.threshold.WithLabelValues(packet.Electricity.ThresholdUnit).Set(packet.Electricity.Threshold)
 
 	p.currentConsumed.Set(packet.Electricity.CurrentConsumed)
@@ -205,17 +267,27 @@ func (p *publisher) Publish(packet *smartmeter.P1Packet) error {
 	p.numberOfPowerFailures.Set(float64(packet.Electricity.NumberOfPowerFailures))
 	p.numberOfLongPowerFailures.Set(float64(packet.Electricity.NumberOfLongPowerFailures))
 
-	for i, v := range packet.Electricity.Tariffs {
-		// Our tariffs are 0-indexed in the slice, while they are named in a 1-index fashion.
-		tariff := strconv.Itoa(i + 1)
+	if c := packet.Electricity.CapacityTariff; c != nil {
+		p.currentAverageDemand.Set(c.CurrentAverageDemand)
+		p.maximumDemand.Set(c.MaximumDemand.Value)
+		if !c.MaximumDemand.Timestamp.IsZero() {
+			p.maximumDemandTimestampSeconds.Set(float64(c.MaximumDemand.Timestamp.Unix()))
+		}
+
+		for _, v := range c.RecordedHistory() {
+			p.maximumDemandHistory.WithLabelValues(v.Timestamp.Format("2006-01")).Set(v.Value)
+		}
+	}
+
+	for _, v := range packet.Electricity.Tariffs {
+		tariff := strconv.Itoa(v.Number)
 
 		p.tariffConsumed.WithLabelValues(tariff).Set(v.Consumed)
 		p.tariffProduced.WithLabelValues(tariff).Set(v.Produced)
 	}
 
-	for i, v := range packet.Electricity.Phases {
-		// Our phases are 0-indexed in the slice, while they are named in a 1-index fashion.
-		phase := strconv.Itoa(i + 1)
+	for _, v := range packet.Electricity.Phases {
+		phase := strconv.Itoa(v.Number)
 
 		p.numberOfVoltageSags.WithLabelValues(phase).Set(float64(v.NumberOfVoltageSags))
 		p.numberOfVoltageSwells.WithLabelValues(phase).Set(float64(v.NumberOfVoltageSwells))
@@ -228,9 +300,30 @@ func (p *publisher) Publish(packet *smartmeter.P1Packet) error {
 
 	p.gasConsumed.Set(packet.Gas.Consumed)
 
+	for _, v := range packet.MBus {
+		p.mbusValue.WithLabelValues(strconv.Itoa(v.Channel), strconv.Itoa(v.DeviceType), v.Kind(), v.Unit).Set(v.Value)
+	}
+
 	return nil
 }
 
 func (p *publisher) Close() error {
 	return p.server.Close()
 }
+
+func (p *publisher) publishMeterInfo(packet *smartmeter.P1Packet) {
+	labels := []string{
+		packet.Header.ManufacturerID,
+		packet.Header.Manufacturer(),
+		packet.Header.Identification,
+		packet.Electricity.EquipmentID,
+		packet.DSMRVersion,
+	}
+
+	if p.meterInfoLabels != nil && !slices.Equal(p.meterInfoLabels, labels) {
+		p.meterInfo.DeleteLabelValues(p.meterInfoLabels...)
+	}
+	p.meterInfoLabels = labels
+
+	p.meterInfo.WithLabelValues(labels...).Set(1)
+}
@@ -0,0 +1,44 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/koesie10/smartmeter/smartmeter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMaximumDemandHistory(t *testing.T) {
+	p, err := NewPublisher(PublisherOptions{
+		Addr:               "127.0.0.1:0",
+		DisableGoCollector: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	packet := &smartmeter.P1Packet{}
+	packet.Electricity.CapacityTariff = &smartmeter.CapacityTariff{
+		MaximumDemandHistory: []smartmeter.MonthlyDemand{
+			{
+				Month:  time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC),
+				Demand: smartmeter.Demand{Timestamp: time.Date(2020, 4, 23, 19, 25, 38, 0, time.UTC), Value: 3.695},
+			},
+			// A month that has not been recorded yet
+			{},
+		},
+	}
+
+	if err := p.Publish(packet); err != nil {
+		t.Fatal(err)
+	}
+
+	history := p.(*publisher).maximumDemandHistory
+	if count := testutil.CollectAndCount(history); count != 1 {
+		t.Errorf("expected 1 month of maximum demand history, got %d", count)
+	}
+	if value := testutil.ToFloat64(history.WithLabelValues("2020-04")); value != 3.695 {
+		t.Errorf("expected maximum demand of 3.695 in 2020-04, got %v", value)
+	}
+}
@@ -0,0 +1,69 @@
+package serialinput
+
+import (
+	"fmt"
+	"io"
+	"net"
+)
+
+// openDatagrams listens for UDP datagrams that each contain a telegram, such as the datagrams that are sent to a
+// multicast group by the expose command. When the address is a multicast group, the group is joined.
+func openDatagrams(opts *NetworkOptions) (io.ReadCloser, error) {
+	addr, err := net.ResolveUDPAddr(opts.Type, opts.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve address %s: %w", opts.Address, err)
+	}
+
+	var conn *net.UDPConn
+	if addr.IP.IsMulticast() {
+		var iface *net.Interface
+		if opts.MulticastInterface != "" {
+			iface, err = net.InterfaceByName(opts.MulticastInterface)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find interface %s: %w", opts.MulticastInterface, err)
+			}
+		}
+
+		conn, err = net.ListenMulticastUDP(opts.Type, iface, addr)
+	} else {
+		conn, err = net.ListenUDP(opts.Type, addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s %s: %w", opts.Type, opts.Address, err)
+	}
+
+	return &datagramReader{
+		r: &timeoutReader{
+			Conn:        conn,
+			readTimeout: opts.ReadTimeout,
+		},
+		buf: make([]byte, 64*1024),
+	}, nil
+}
+
+// datagramReader reads whole datagrams, since the part of a datagram that does not fit in the buffer of a read is
+// discarded.
+type datagramReader struct {
+	r    io.ReadCloser
+	buf  []byte
+	data []byte
+}
+
+func (r *datagramReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		n, err := r.r.Read(r.buf)
+		if err != nil {
+			return 0, err
+		}
+		r.data = r.buf[:n]
+	}
+
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+
+	return n, nil
+}
+
+func (r *datagramReader) Close() error {
+	return r.r.Close()
+}
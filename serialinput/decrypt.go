@@ -0,0 +1,202 @@
+package serialinput
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+const (
+	// generalGloCipheringTag is the tag of a DLMS general-glo-ciphering APDU
+	generalGloCipheringTag = 0xDB
+
+	// maxFrameLength is the maximum length of the ciphered part of a frame, which is well above the size of a
+	// telegram
+	maxFrameLength = 16 * 1024
+
+	gcmTagSize = 12
+)
+
+type DecryptionOptions struct {
+	Key               string `env:"DECRYPTION_KEY" flag:"key" desc:"hex encoded AES-128 key to decrypt DLMS frames of Luxembourg Smarty meters, leave empty to disable decryption"`
+	AuthenticationKey string `env:"DECRYPTION_AUTHENTICATION_KEY" flag:"authentication-key" desc:"hex encoded authentication key of DLMS frames"`
+}
+
+// OpenDecrypt wraps r so the encrypted DLMS frames read from it are decrypted into plain telegrams.
+func OpenDecrypt(r io.ReadCloser, opts *DecryptionOptions) (io.ReadCloser, error) {
+	key, err := hex.DecodeString(opts.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decryption key: %w", err)
+	}
+
+	authenticationKey, err := hex.DecodeString(opts.AuthenticationKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authentication key: %w", err)
+	}
+
+	return NewDecryptReader(r, key, authenticationKey)
+}
+
+// NewDecryptReader returns a reader that reads DLMS general-glo-ciphering frames as sent by Luxembourg Smarty meters
+// from r and returns the decrypted telegrams. Frames that cannot be decrypted are skipped.
+func NewDecryptReader(r io.ReadCloser, key, authenticationKey []byte) (io.ReadCloser, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCMWithTagSize(block, gcmTagSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return &decryptReader{
+		r:                 bufio.NewReader(r),
+		closer:            r,
+		gcm:               gcm,
+		authenticationKey: authenticationKey,
+	}, nil
+}
+
+type decryptReader struct {
+	r      *bufio.Reader
+	closer io.Closer
+
+	gcm               cipher.AEAD
+	authenticationKey []byte
+
+	// plaintext contains the part of the last decrypted frame that has not been read yet
+	plaintext []byte
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plaintext) == 0 {
+		frame, err := r.readFrame()
+		if err != nil {
+			return 0, err
+		}
+
+		r.plaintext, err = r.decrypt(frame)
+		if err != nil {
+			log.Printf("Skipping DLMS frame: %v", err)
+		}
+	}
+
+	n := copy(p, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+
+	return n, nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.closer.Close()
+}
+
+// dlmsFrame is a general-glo-ciphering frame, which has the format:
+// 0xDB | system title length | system title | length | security control | frame counter | ciphertext | tag
+type dlmsFrame struct {
+	systemTitle     []byte
+	securityControl byte
+	frameCounter    []byte
+	ciphertext      []byte
+}
+
+// readFrame reads the next frame, skipping any data before the start of the frame.
+func (r *decryptReader) readFrame() (*dlmsFrame, error) {
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if b != generalGloCipheringTag {
+			continue
+		}
+
+		systemTitleLength, err := r.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if systemTitleLength != 8 {
+			// This is not the start of a frame, but a 0xDB somewhere else in the data
+			continue
+		}
+
+		frame := &dlmsFrame{
+			systemTitle: make([]byte, systemTitleLength),
+		}
+		if _, err := io.ReadFull(r.r, frame.systemTitle); err != nil {
+			return nil, err
+		}
+
+		length, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		if length < 5+gcmTagSize || length > maxFrameLength {
+			continue
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			return nil, err
+		}
+
+		frame.securityControl = data[0]
+		frame.frameCounter = data[1:5]
+		frame.ciphertext = data[5:]
+
+		return frame, nil
+	}
+}
+
+// readLength reads a BER encoded length.
+func (r *decryptReader) readLength() (int, error) {
+	b, err := r.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	if b < 0x80 {
+		return int(b), nil
+	}
+
+	n := int(b & 0x7F)
+	if n == 0 || n > 2 {
+		return 0, nil
+	}
+
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(r.r, buf[2-n:]); err != nil {
+		return 0, err
+	}
+
+	return int(binary.BigEndian.Uint16(buf)), nil
+}
+
+func (r *decryptReader) decrypt(frame *dlmsFrame) ([]byte, error) {
+	nonce := make([]byte, 0, len(frame.systemTitle)+len(frame.frameCounter))
+	nonce = append(nonce, frame.systemTitle...)
+	nonce = append(nonce, frame.frameCounter...)
+
+	if len(nonce) != r.gcm.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+
+	additionalData := make([]byte, 0, 1+len(r.authenticationKey))
+	additionalData = append(additionalData, frame.securityControl)
+	additionalData = append(additionalData, r.authenticationKey...)
+
+	plaintext, err := r.gcm.Open(nil, nonce, frame.ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt frame %x: %w", frame.frameCounter, err)
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,129 @@
+package serialinput_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koesie10/smartmeter/serialinput"
+	"github.com/koesie10/smartmeter/smartmeter"
+)
+
+func TestDecrypt(t *testing.T) {
+	frame, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "smarty.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "smarty.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data []byte
+	data = append(data, "garbage"...)
+	data = append(data, frame...)
+	data = append(data, frame...)
+
+	r, err := serialinput.OpenDecrypt(io.NopCloser(bytes.NewReader(data)), &serialinput.DecryptionOptions{
+		Key:               "000102030405060708090A0B0C0D0E0F",
+		AuthenticationKey: "00112233445566778899AABBCCDDEEFF",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(plaintext, append(expected, expected...)) {
+		t.Fatalf("expected decrypted telegrams to match smarty.txt, got %q", plaintext)
+	}
+
+	sm, err := smartmeter.New(bytes.NewReader(plaintext), smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet, err := sm.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if packet.Electricity.CurrentConsumed != 0.145 {
+		t.Errorf("expected current consumption of 0.145, got %v", packet.Electricity.CurrentConsumed)
+	}
+	if tariffs := packet.Electricity.Tariffs; len(tariffs) != 1 || tariffs[0] != (smartmeter.Tariff{Number: 0, Consumed: 227.445, Produced: 0}) {
+		t.Errorf("expected the total delivery of 227.445 kWh, got %+v", tariffs)
+	}
+	if e := packet.Electricity; e.ReactiveConsumed != 0.106 || e.ReactiveProduced != 37.698 || e.CurrentReactiveConsumed != 0 || e.CurrentReactiveProduced != 0.082 {
+		t.Errorf("expected reactive energy and power to be parsed, got %+v", e)
+	}
+	if packet.Electricity.EquipmentID != "53414733303330313132313030333337" {
+		t.Errorf("expected the logical device name as equipment ID, got %q", packet.Electricity.EquipmentID)
+	}
+	if len(packet.Unknown) != 0 {
+		t.Errorf("expected all objects to be recognised, got %v", packet.Unknown)
+	}
+}
+
+// TestDecryptGreenBook decrypts the example of authenticated encryption in the DLMS UA Green Book, which is not
+// generated by this package.
+func TestDecryptGreenBook(t *testing.T) {
+	ciphertext, err := hex.DecodeString("411312FF935A47566827C467BC" + "7D825C3BE4A77C3FCC056B6B")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var frame []byte
+	frame = append(frame, 0xDB, 0x08, 0x4D, 0x4D, 0x4D, 0x00, 0x00, 0xBC, 0x61, 0x4E)
+	frame = append(frame, byte(5+len(ciphertext)), 0x30, 0x01, 0x23, 0x45, 0x67)
+	frame = append(frame, ciphertext...)
+
+	r, err := serialinput.OpenDecrypt(io.NopCloser(bytes.NewReader(frame)), &serialinput.DecryptionOptions{
+		Key:               "000102030405060708090A0B0C0D0E0F",
+		AuthenticationKey: "D0D1D2D3D4D5D6D7D8D9DADBDCDDDEDF",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "C0010000080000010000FF0200"; strings.ToUpper(hex.EncodeToString(plaintext)) != expected {
+		t.Errorf("expected plaintext %s, got %X", expected, plaintext)
+	}
+}
+
+func TestDecryptInvalidKey(t *testing.T) {
+	frame, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "smarty.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := serialinput.OpenDecrypt(io.NopCloser(bytes.NewReader(frame)), &serialinput.DecryptionOptions{
+		Key:               "0F0E0D0C0B0A09080706050403020100",
+		AuthenticationKey: "00112233445566778899AABBCCDDEEFF",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plaintext) != 0 {
+		t.Fatalf("expected frame to be skipped, got %q", plaintext)
+	}
+}
@@ -0,0 +1,45 @@
+package serialinput
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// fifoReader reads from a named pipe. A named pipe returns io.EOF when its last writer closes it, so the reader keeps
+// a write end open itself. Reads then wait for the next writer instead, and Close unblocks a pending Read.
+type fifoReader struct {
+	file   *os.File
+	writer *os.File
+}
+
+func openFIFO(name string) (io.ReadCloser, error) {
+	// Opening the read end of a named pipe blocks until it is opened by a writer, unless it is opened non-blocking
+	file, err := os.OpenFile(name, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open named pipe %s: %w", name, err)
+	}
+
+	writer, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open write end of named pipe %s: %w", name, err)
+	}
+
+	return &fifoReader{
+		file:   file,
+		writer: writer,
+	}, nil
+}
+
+func (r *fifoReader) Read(p []byte) (int, error) {
+	return r.file.Read(p)
+}
+
+func (r *fifoReader) Close() error {
+	err := r.file.Close()
+	r.writer.Close()
+
+	return err
+}
@@ -0,0 +1,78 @@
+//go:build unix
+
+package serialinput_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/koesie10/smartmeter/serialinput"
+	"github.com/koesie10/smartmeter/smartmeter"
+)
+
+func TestFIFO(t *testing.T) {
+	telegram, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "p1")
+	if err := syscall.Mkfifo(name, 0o600); err != nil {
+		t.Skipf("failed to create named pipe: %v", err)
+	}
+
+	// Opening the named pipe does not wait for a writer
+	r, err := serialinput.OpenFile(&serialinput.FileOptions{Filename: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	sm, err := smartmeter.New(r, smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every writer writes a telegram and closes the named pipe, after which the next writer is read
+	for i := 0; i < 2; i++ {
+		w, err := os.OpenFile(name, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(telegram); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := sm.Read(); err != nil {
+			t.Fatalf("telegram %d: %v", i, err)
+		}
+	}
+
+	// Close unblocks a Read that is waiting for the next writer
+	errs := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 16))
+		errs <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, os.ErrClosed) {
+			t.Errorf("expected %v, got %v", os.ErrClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for Read to return after Close")
+	}
+}
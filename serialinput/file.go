@@ -5,6 +5,8 @@ import (
 	"io"
 	"os"
 	"time"
+
+	"github.com/koesie10/smartmeter/capture"
 )
 
 type FileOptions struct {
@@ -12,9 +14,16 @@ type FileOptions struct {
 
 	Repeat      bool          `env:"FILE_REPEAT" flag:"repeat" desc:"if set, the file will be offered repeatedly"`
 	RepeatDelay time.Duration `env:"FILE_REPEAT_DELAY" flag:"repeat-delay" desc:"delay between repetitions"`
+
+	Capture         bool `env:"FILE_CAPTURE" flag:"capture" desc:"if set, the file is a capture written by the record command"`
+	CaptureRealtime bool `env:"FILE_CAPTURE_REALTIME" flag:"capture-realtime" desc:"if set, the capture is replayed at its original timing instead of as fast as possible"`
 }
 
 func OpenFile(opts *FileOptions) (io.ReadCloser, error) {
+	if opts.Capture {
+		return openCapture(opts)
+	}
+
 	if opts.Repeat {
 		data, err := os.ReadFile(opts.Filename)
 		if err != nil {
@@ -24,9 +33,14 @@ func OpenFile(opts *FileOptions) (io.ReadCloser, error) {
 		return &dataRepeater{
 			data:   data,
 			ticker: time.NewTicker(opts.RepeatDelay),
+			done:   make(chan struct{}),
 		}, nil
 	}
 
+	if info, err := os.Stat(opts.Filename); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		return openFIFO(opts.Filename)
+	}
+
 	file, err := os.Open(opts.Filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file %s: %w", opts.Filename, err)
@@ -39,23 +53,110 @@ type dataRepeater struct {
 	data []byte
 
 	ticker *time.Ticker
+	done   chan struct{}
 }
 
 func (r *dataRepeater) Read(p []byte) (int, error) {
-	if r.ticker == nil {
+	select {
+	case <-r.done:
 		return 0, io.EOF
+	case <-r.ticker.C:
 	}
 
-	<-r.ticker.C
-
 	n := copy(p, r.data)
 
 	return n, nil
 }
 
 func (r *dataRepeater) Close() error {
-	r.ticker.Stop()
-	r.ticker = nil
+	select {
+	case <-r.done:
+	default:
+		r.ticker.Stop()
+		close(r.done)
+	}
 
 	return nil
 }
+
+func openCapture(opts *FileOptions) (io.ReadCloser, error) {
+	file, err := os.Open(opts.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", opts.Filename, err)
+	}
+
+	r, err := capture.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read capture %s: %w", opts.Filename, err)
+	}
+
+	return &captureReplayer{
+		file:     file,
+		r:        r,
+		realtime: opts.CaptureRealtime,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// captureReplayer reads the telegrams of a capture, optionally waiting between telegrams for as long as was waited when
+// they were recorded.
+type captureReplayer struct {
+	file     *os.File
+	r        *capture.Reader
+	realtime bool
+
+	last time.Time
+	buf  []byte
+
+	done chan struct{}
+}
+
+func (r *captureReplayer) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		record, err := r.r.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		if r.realtime && !r.last.IsZero() {
+			if err := r.wait(record.Time.Sub(r.last)); err != nil {
+				return 0, err
+			}
+		}
+		r.last = record.Time
+		r.buf = record.Telegram
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+func (r *captureReplayer) wait(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-r.done:
+		return os.ErrClosed
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (r *captureReplayer) Close() error {
+	select {
+	case <-r.done:
+		return nil
+	default:
+		close(r.done)
+	}
+
+	return r.file.Close()
+}
@@ -7,23 +7,64 @@ import (
 )
 
 type Options struct {
-	InputType InputType `env:"INPUT_TYPE" flag:"input-type" desc:"input type to read from"`
+	InputType InputType `env:"INPUT_TYPE" flag:"input-type" desc:"input type to read from: serial, file, network, stdin, http or mqtt"`
 
 	Serial *SerialOptions `env:",squash"`
 
 	File *FileOptions `env:",squash"`
 
 	Network *NetworkOptions `env:",squash"`
+
+	HTTP *HTTPOptions `env:",squash"`
+
+	MQTTInput *MQTTOptions `env:",squash"`
+
+	Decryption *DecryptionOptions `env:",squash"`
+
+	Reconnect *ReconnectOptions `env:",squash"`
 }
 
 func Open(opts *Options) (io.ReadCloser, error) {
+	if opts.Reconnect != nil && opts.Reconnect.Enabled {
+		return openReconnecting(opts)
+	}
+
+	return openDecrypted(opts)
+}
+
+func openDecrypted(opts *Options) (io.ReadCloser, error) {
+	r, err := openInput(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Decryption != nil && opts.Decryption.Key != "" {
+		dr, err := OpenDecrypt(r, opts.Decryption)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+
+		return dr, nil
+	}
+
+	return r, nil
+}
+
+func openInput(opts *Options) (io.ReadCloser, error) {
 	switch opts.InputType {
 	case SerialPort:
 		return OpenSerial(opts.Serial)
 	case File:
 		return OpenFile(opts.File)
 	case Network:
-		return OpenNetwork(opts.Network)
+		return OpenNetwork(opts.Network, opts.Serial)
+	case Stdin:
+		return OpenStdin()
+	case HTTP:
+		return OpenHTTP(opts.HTTP)
+	case MQTT:
+		return OpenMQTT(opts.MQTTInput)
 	}
 
 	return nil, fmt.Errorf("unknown input type %v", opts.InputType)
@@ -35,6 +76,9 @@ const (
 	SerialPort InputType = iota
 	File
 	Network
+	Stdin
+	HTTP
+	MQTT
 )
 
 func (m *InputType) String() string {
@@ -45,6 +89,12 @@ func (m *InputType) String() string {
 		return "file"
 	case Network:
 		return "network"
+	case Stdin:
+		return "stdin"
+	case HTTP:
+		return "http"
+	case MQTT:
+		return "mqtt"
 	}
 	panic("invalid input type")
 }
@@ -61,6 +111,12 @@ func (m *InputType) Set(str string) error {
 		*m = File
 	case "network":
 		*m = Network
+	case "stdin":
+		*m = Stdin
+	case "http":
+		*m = HTTP
+	case "mqtt":
+		*m = MQTT
 	default:
 		return fmt.Errorf("unknown input type %q", str)
 	}
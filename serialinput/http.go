@@ -0,0 +1,126 @@
+package serialinput
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxHTTPTelegramSize is the maximum size of a response of the HTTP input.
+const maxHTTPTelegramSize = 64 * 1024
+
+type HTTPOptions struct {
+	URL      string        `env:"HTTP_URL" flag:"url" desc:"URL that serves the latest raw telegram, such as http://192.168.1.10/api/v1/telegram for HomeWizard P1 meters"`
+	Interval time.Duration `env:"HTTP_INTERVAL" flag:"interval" desc:"interval at which the URL is polled"`
+	Timeout  time.Duration `env:"HTTP_TIMEOUT" flag:"timeout" desc:"timeout of a single request"`
+}
+
+// OpenHTTP returns an input that polls a URL serving the latest raw telegram, such as the HTTP API of Wi-Fi P1 dongles.
+// Telegrams that are identical to the previous telegram are skipped, since the dongle has not received a new telegram
+// from the meter in that case.
+func OpenHTTP(opts *HTTPOptions) (io.ReadCloser, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("no URL to poll")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &httpPoller{
+		opts: opts,
+		client: &http.Client{
+			Timeout: opts.Timeout,
+		},
+
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+type httpPoller struct {
+	opts   *HTTPOptions
+	client *http.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lastPoll time.Time
+	last     []byte
+	buf      []byte
+}
+
+func (r *httpPoller) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if err := r.wait(); err != nil {
+			return 0, err
+		}
+
+		telegram, err := r.poll()
+		if err != nil {
+			return 0, err
+		}
+
+		if bytes.Equal(telegram, r.last) {
+			continue
+		}
+		r.last = telegram
+
+		// Some dongles strip the line ending after the checksum, which is needed to find the end of the telegram
+		r.buf = append(telegram, "\r\n"...)
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// wait waits until the next poll is due.
+func (r *httpPoller) wait() error {
+	if !r.lastPoll.IsZero() {
+		timer := time.NewTimer(time.Until(r.lastPoll.Add(r.opts.Interval)))
+		defer timer.Stop()
+
+		select {
+		case <-r.ctx.Done():
+			return r.ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	r.lastPoll = time.Now()
+
+	return nil
+}
+
+func (r *httpPoller) poll() ([]byte, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.opts.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll %s: %w", r.opts.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to poll %s: unexpected status %s", r.opts.URL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPTelegramSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response of %s: %w", r.opts.URL, err)
+	}
+
+	return bytes.TrimRight(body, "\r\n"), nil
+}
+
+func (r *httpPoller) Close() error {
+	r.cancel()
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package serialinput_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koesie10/smartmeter/serialinput"
+	"github.com/koesie10/smartmeter/smartmeter"
+)
+
+func TestHTTP(t *testing.T) {
+	first, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "esmr50_mbus.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first telegram is served a few times before the second one, like a dongle that is polled more often than
+	// the meter sends telegrams
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 3 {
+			w.Write(first)
+		} else {
+			w.Write(second)
+		}
+	}))
+	defer server.Close()
+
+	r, err := serialinput.OpenHTTP(&serialinput.HTTPOptions{
+		URL:      server.URL,
+		Interval: time.Millisecond,
+		Timeout:  time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	sm, err := smartmeter.New(r, smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet, err := sm.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packet.MBus) != 1 {
+		t.Errorf("expected 1 M-Bus device in the first telegram, got %d", len(packet.MBus))
+	}
+
+	packet, err = sm.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packet.MBus) < 2 {
+		t.Errorf("expected the second telegram after the duplicates of the first telegram, got %d M-Bus devices", len(packet.MBus))
+	}
+	if n := requests.Load(); n < 4 {
+		t.Errorf("expected at least 4 requests, got %d", n)
+	}
+}
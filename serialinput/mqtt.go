@@ -0,0 +1,146 @@
+package serialinput
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	mqttclient "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttQueueSize is the number of telegrams that are buffered when they are received faster than they are read.
+const mqttQueueSize = 16
+
+type MQTTOptions struct {
+	Brokers  []string `env:"MQTT_INPUT_BROKERS" flag:"brokers" desc:"MQTT broker addresses to receive telegrams from, such as tcp://127.0.0.1:1883 or ssl://127.0.0.1:8883"`
+	ClientID string   `env:"MQTT_INPUT_CLIENT_ID" flag:"client-id" desc:"MQTT client ID, default will be autogenerated based on the client hostname"`
+	Username string   `env:"MQTT_INPUT_USERNAME" flag:"username" desc:"MQTT username"`
+	Password string   `env:"MQTT_INPUT_PASSWORD" flag:"password" desc:"MQTT password"`
+
+	Topic string `env:"MQTT_INPUT_TOPIC" flag:"topic" desc:"topic on which the raw telegrams are published"`
+	QoS   int    `env:"MQTT_INPUT_QOS" flag:"qos" desc:"the QoS to subscribe at"`
+
+	CAFile             string `env:"MQTT_INPUT_CA_FILE" flag:"ca-file" desc:"PEM encoded CA certificate to verify the broker with, in addition to the system certificates"`
+	CertFile           string `env:"MQTT_INPUT_CERT_FILE" flag:"cert-file" desc:"PEM encoded client certificate to authenticate with"`
+	KeyFile            string `env:"MQTT_INPUT_KEY_FILE" flag:"key-file" desc:"PEM encoded key of the client certificate"`
+	InsecureSkipVerify bool   `env:"MQTT_INPUT_INSECURE_SKIP_VERIFY" flag:"insecure-skip-verify" desc:"do not verify the certificate of the broker"`
+}
+
+// OpenMQTT subscribes to the topic on which raw telegrams are published, for example by a P1 reader on an ESP32, and
+// returns the payloads as a stream of telegrams. The subscription is restored when the connection to the broker is
+// lost.
+func OpenMQTT(opts *MQTTOptions) (io.ReadCloser, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, fmt.Errorf("no MQTT brokers to connect to")
+	}
+	if opts.Topic == "" {
+		return nil, fmt.Errorf("no MQTT topic to subscribe to")
+	}
+
+	clientID := opts.ClientID
+	if clientID == "" {
+		hostname, _ := os.Hostname()
+		clientID = fmt.Sprintf("%s-input-%d", hostname, time.Now().Unix())
+	}
+
+	r := &mqttReader{
+		telegrams: make(chan []byte, mqttQueueSize),
+		done:      make(chan struct{}),
+	}
+
+	connOpts := mqttclient.NewClientOptions().SetClientID(clientID).SetCleanSession(true)
+
+	for _, broker := range opts.Brokers {
+		connOpts.AddBroker(broker)
+	}
+
+	if opts.Username != "" {
+		connOpts.SetUsername(opts.Username)
+		if opts.Password != "" {
+			connOpts.SetPassword(opts.Password)
+		}
+	}
+
+	if opts.CAFile != "" || opts.CertFile != "" || opts.KeyFile != "" || opts.InsecureSkipVerify {
+		tlsConfig, err := loadTLSConfig(opts.CAFile, opts.CertFile, opts.KeyFile, opts.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		connOpts.SetTLSConfig(tlsConfig)
+	}
+
+	connOpts.SetAutoReconnect(true)
+	connOpts.SetOnConnectHandler(func(client mqttclient.Client) {
+		// The subscription is made on every connect, since the session is not kept by the broker
+		token := client.Subscribe(opts.Topic, byte(opts.QoS), r.receive)
+		go func() {
+			token.Wait()
+			if err := token.Error(); err != nil {
+				log.Printf("Failed to subscribe to MQTT topic %s: %v", opts.Topic, err)
+			}
+		}()
+	})
+	connOpts.SetConnectionLostHandler(func(client mqttclient.Client, err error) {
+		log.Printf("Lost connection to MQTT broker: %v", err)
+	})
+
+	r.client = mqttclient.NewClient(connOpts)
+
+	token := r.client.Connect()
+	token.Wait()
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+
+	return r, nil
+}
+
+type mqttReader struct {
+	client mqttclient.Client
+
+	telegrams chan []byte
+	buf       []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (r *mqttReader) receive(client mqttclient.Client, message mqttclient.Message) {
+	// Some readers strip the line ending after the checksum, which is needed to find the end of the telegram
+	telegram := append(bytes.Clone(bytes.TrimRight(message.Payload(), "\r\n")), "\r\n"...)
+
+	select {
+	case r.telegrams <- telegram:
+	default:
+		log.Printf("Dropped telegram from MQTT topic %s, since telegrams are received faster than they are read", message.Topic())
+	}
+}
+
+func (r *mqttReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		select {
+		case <-r.done:
+			return 0, io.EOF
+		case r.buf = <-r.telegrams:
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+func (r *mqttReader) Close() error {
+	r.closeOnce.Do(func() {
+		// Disconnecting first stops the delivery of messages, so no telegrams are received after Close
+		r.client.Disconnect(250)
+		close(r.done)
+	})
+
+	return nil
+}
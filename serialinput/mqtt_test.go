@@ -0,0 +1,142 @@
+package serialinput
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	mqttclient "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeMQTTClient records calls to Disconnect, other methods of the client are not used by mqttReader after connecting.
+type fakeMQTTClient struct {
+	mqttclient.Client
+
+	r           *mqttReader
+	disconnects int
+	doneClosed  bool
+}
+
+func (c *fakeMQTTClient) Disconnect(quiesce uint) {
+	c.disconnects++
+
+	select {
+	case <-c.r.done:
+		c.doneClosed = true
+	default:
+	}
+}
+
+type fakeMQTTMessage struct {
+	mqttclient.Message
+
+	payload []byte
+}
+
+func (m *fakeMQTTMessage) Topic() string {
+	return "dsmr/raw"
+}
+
+func (m *fakeMQTTMessage) Payload() []byte {
+	return m.payload
+}
+
+func newTestMQTTReader() (*mqttReader, *fakeMQTTClient) {
+	r := &mqttReader{
+		telegrams: make(chan []byte, mqttQueueSize),
+		done:      make(chan struct{}),
+	}
+	client := &fakeMQTTClient{r: r}
+	r.client = client
+
+	return r, client
+}
+
+func TestMQTTReader(t *testing.T) {
+	r, _ := newTestMQTTReader()
+
+	for _, payload := range []string{"/ISk5\r\n!1234\r\n", "/ISk5\r\n!5678", "/ISk5\r\n!9ABC\n"} {
+		r.receive(nil, &fakeMQTTMessage{payload: []byte(payload)})
+	}
+
+	// Reads smaller than the telegram return the rest of it in the next reads
+	buf := make([]byte, 5)
+	var data []byte
+	for len(data) < 3*len("/ISk5\r\n!1234\r\n") {
+		n, err := r.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > len(buf) || n == 0 {
+			t.Fatalf("unexpected read of %d bytes", n)
+		}
+		data = append(data, buf[:n]...)
+	}
+
+	if expected := "/ISk5\r\n!1234\r\n/ISk5\r\n!5678\r\n/ISk5\r\n!9ABC\r\n"; string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, data)
+	}
+}
+
+func TestMQTTReaderQueue(t *testing.T) {
+	r, _ := newTestMQTTReader()
+
+	// Telegrams are dropped instead of blocking the client when the queue is full
+	for i := 0; i < mqttQueueSize+1; i++ {
+		r.receive(nil, &fakeMQTTMessage{payload: []byte(fmt.Sprintf("/ISk5\r\n!%04d\r\n", i))})
+	}
+
+	if len(r.telegrams) != mqttQueueSize {
+		t.Errorf("expected %d queued telegrams, got %d", mqttQueueSize, len(r.telegrams))
+	}
+
+	// The payload is copied, so the client can reuse it
+	payload := []byte("/ISk5\r\n!0000\r\n")
+	r, _ = newTestMQTTReader()
+	r.receive(nil, &fakeMQTTMessage{payload: payload})
+	copy(payload, "XXXXX")
+
+	data := make([]byte, 64)
+	n, err := r.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:n]) != "/ISk5\r\n!0000\r\n" {
+		t.Errorf("expected telegram to be copied, got %q", data[:n])
+	}
+}
+
+func TestMQTTReaderClose(t *testing.T) {
+	r, client := newTestMQTTReader()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 16))
+		errs <- err
+	}()
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("expected %v, got %v", io.EOF, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for Read to return after Close")
+	}
+
+	if client.disconnects != 1 {
+		t.Errorf("expected client to be disconnected once, got %d", client.disconnects)
+	}
+	if client.doneClosed {
+		t.Error("expected client to be disconnected before reads are stopped")
+	}
+}
@@ -1,6 +1,7 @@
 package serialinput
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -8,22 +9,69 @@ import (
 )
 
 type NetworkOptions struct {
-	Type        string        `env:"NETWORK_TYPE" flag:"type" desc:"network type"`
-	Address     string        `env:"NETWORK_ADDRESS" flag:"address" desc:"network address"`
+	Type        string        `env:"NETWORK_TYPE" flag:"type" desc:"network type: tcp, unix for a Unix domain socket or udp to receive datagrams, such as from a multicast group"`
+	Address     string        `env:"NETWORK_ADDRESS" flag:"address" desc:"network address, the path of a Unix domain socket or the address to receive datagrams on"`
 	DialTimeout time.Duration `env:"NETWORK_DIAL_TIMEOUT" flag:"dial-timeout" desc:"network dial timeout"`
 	ReadTimeout time.Duration `env:"NETWORK_READ_TIMEOUT" flag:"read-timeout" desc:"network read timeout"`
+
+	MulticastInterface string `env:"NETWORK_MULTICAST_INTERFACE" flag:"multicast-interface" desc:"name of the interface to join the multicast group on, leave empty to use the default interface"`
+
+	RFC2217 bool `env:"NETWORK_RFC2217" flag:"rfc2217" desc:"if set, the server is an RFC 2217 serial server, such as ser2net in telnet mode, which is configured with the serial settings"`
+
+	TLS                   bool   `env:"NETWORK_TLS" flag:"tls" desc:"if set, the connection is secured with TLS, such as to the expose command with a server certificate"`
+	TLSCAFile             string `env:"NETWORK_TLS_CA_FILE" flag:"tls-ca-file" desc:"PEM encoded CA certificate to verify the server with, in addition to the system certificates"`
+	TLSCertFile           string `env:"NETWORK_TLS_CERT_FILE" flag:"tls-cert-file" desc:"PEM encoded client certificate to authenticate with"`
+	TLSKeyFile            string `env:"NETWORK_TLS_KEY_FILE" flag:"tls-key-file" desc:"PEM encoded key of the client certificate"`
+	TLSInsecureSkipVerify bool   `env:"NETWORK_TLS_INSECURE_SKIP_VERIFY" flag:"tls-insecure-skip-verify" desc:"do not verify the certificate of the server"`
 }
 
-func OpenNetwork(opts *NetworkOptions) (io.ReadCloser, error) {
-	conn, err := net.DialTimeout(opts.Type, opts.Address, opts.DialTimeout)
+// OpenNetwork dials the network address and reads the telegrams from the connection, or listens for datagrams for the
+// udp network types. In RFC 2217 mode, the baud rate, data bits, stop bits and parity mode of serialOpts are sent to
+// the server.
+func OpenNetwork(opts *NetworkOptions, serialOpts *SerialOptions) (io.ReadCloser, error) {
+	switch opts.Type {
+	case "udp", "udp4", "udp6":
+		return openDatagrams(opts)
+	}
+
+	conn, err := dialNetwork(opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial to network %s %s: %w", opts.Type, opts.Address, err)
 	}
 
-	return &timeoutReader{
+	r := &timeoutReader{
 		Conn:        conn,
 		readTimeout: opts.ReadTimeout,
-	}, nil
+	}
+
+	if opts.RFC2217 {
+		tr, err := openRFC2217(r, serialOpts)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return tr, nil
+	}
+
+	return r, nil
+}
+
+func dialNetwork(opts *NetworkOptions) (net.Conn, error) {
+	if !opts.TLS {
+		return net.DialTimeout(opts.Type, opts.Address, opts.DialTimeout)
+	}
+
+	tlsConfig, err := loadTLSConfig(opts.TLSCAFile, opts.TLSCertFile, opts.TLSKeyFile, opts.TLSInsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout: opts.DialTimeout,
+	}
+
+	return tls.DialWithDialer(dialer, opts.Type, opts.Address, tlsConfig)
 }
 
 type timeoutReader struct {
@@ -0,0 +1,201 @@
+package serialinput
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ReconnectOptions struct {
+	Enabled    bool          `env:"RECONNECT_ENABLED" flag:"enabled" desc:"reopen the input with exponential backoff when reading from it fails"`
+	MinBackoff time.Duration `env:"RECONNECT_MIN_BACKOFF" flag:"min-backoff" desc:"time to wait before reopening the input the first time"`
+	MaxBackoff time.Duration `env:"RECONNECT_MAX_BACKOFF" flag:"max-backoff" desc:"maximum time to wait between attempts to reopen the input"`
+}
+
+// Reconnects returns the number of times the input returned by Open has been reopened, which is always 0 for inputs
+// that are not reopened.
+func Reconnects(r io.Reader) uint64 {
+	if rr, ok := r.(*reconnectReader); ok {
+		return rr.reconnects.Load()
+	}
+	return 0
+}
+
+func openReconnecting(opts *Options) (io.ReadCloser, error) {
+	// A backoff of 0 would reopen an input that keeps failing without waiting
+	if opts.Reconnect.MinBackoff <= 0 || opts.Reconnect.MinBackoff > opts.Reconnect.MaxBackoff {
+		return nil, fmt.Errorf("invalid reconnect backoff: the minimum backoff %v must be positive and at most the maximum backoff %v", opts.Reconnect.MinBackoff, opts.Reconnect.MaxBackoff)
+	}
+
+	r, err := openDecrypted(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reconnectReader{
+		// The input is opened by its name again, so a symlink such as /dev/serial/by-id follows the adapter to its
+		// new device after it is plugged in again
+		open: func() (io.ReadCloser, error) {
+			return openDecrypted(opts)
+		},
+		name:    describeInput(opts),
+		options: opts.Reconnect,
+		// The end of a file or stdin is not a disconnect, but the end of the input
+		reconnectOnEOF: opts.InputType != File && opts.InputType != Stdin,
+
+		r:       r,
+		backoff: opts.Reconnect.MinBackoff,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+func describeInput(opts *Options) string {
+	switch opts.InputType {
+	case SerialPort:
+		return opts.Serial.Port
+	case File:
+		return opts.File.Filename
+	case Network:
+		return fmt.Sprintf("%s %s", opts.Network.Type, opts.Network.Address)
+	case HTTP:
+		return opts.HTTP.URL
+	case MQTT:
+		return fmt.Sprintf("MQTT topic %s", opts.MQTTInput.Topic)
+	}
+	return opts.InputType.String()
+}
+
+// reconnectReader reads from an input and reopens it when reading fails, such as when a USB serial adapter is
+// unplugged or a TCP connection is dropped.
+type reconnectReader struct {
+	open           func() (io.ReadCloser, error)
+	name           string
+	options        *ReconnectOptions
+	reconnectOnEOF bool
+
+	mu      sync.Mutex
+	r       io.ReadCloser
+	backoff time.Duration
+	closed  bool
+	done    chan struct{}
+
+	reconnects atomic.Uint64
+}
+
+func (r *reconnectReader) Read(p []byte) (int, error) {
+	for {
+		rc, err := r.current()
+		if err != nil {
+			return 0, err
+		}
+
+		if rc == nil {
+			if rc, err = r.reopen(); err != nil {
+				return 0, err
+			}
+			if rc == nil {
+				continue
+			}
+		}
+
+		n, err := rc.Read(p)
+		if n > 0 {
+			r.mu.Lock()
+			r.backoff = r.options.MinBackoff
+			r.mu.Unlock()
+
+			return n, nil
+		}
+		if err == nil {
+			continue
+		}
+
+		if errors.Is(err, io.EOF) && !r.reconnectOnEOF {
+			return 0, err
+		}
+
+		r.mu.Lock()
+		closed := r.closed
+		if !closed {
+			r.r = nil
+		}
+		r.mu.Unlock()
+
+		if closed {
+			return 0, err
+		}
+
+		rc.Close()
+		log.Printf("Failed to read from %s: %v", r.name, err)
+	}
+}
+
+func (r *reconnectReader) current() (io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, os.ErrClosed
+	}
+	return r.r, nil
+}
+
+// reopen waits for the backoff and reopens the input. It returns a nil reader if reopening failed and should be retried.
+func (r *reconnectReader) reopen() (io.ReadCloser, error) {
+	r.mu.Lock()
+	backoff := r.backoff
+	r.backoff = min(r.backoff*2, r.options.MaxBackoff)
+	r.mu.Unlock()
+
+	log.Printf("Reopening %s in %v", r.name, backoff)
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-r.done:
+		return nil, os.ErrClosed
+	case <-timer.C:
+	}
+
+	rc, err := r.open()
+	if err != nil {
+		log.Printf("Failed to reopen %s: %v", r.name, err)
+		return nil, nil
+	}
+
+	r.reconnects.Add(1)
+	log.Printf("Reopened %s", r.name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		rc.Close()
+		return nil, os.ErrClosed
+	}
+	r.r = rc
+
+	return rc, nil
+}
+
+func (r *reconnectReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+
+	if r.r != nil {
+		return r.r.Close()
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package serialinput
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeInput returns the results of reads in order, and EOF after the last one.
+type fakeInput struct {
+	mu     sync.Mutex
+	reads  []fakeRead
+	closed bool
+}
+
+type fakeRead struct {
+	data string
+	err  error
+}
+
+func (f *fakeInput) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.reads) == 0 {
+		return 0, io.EOF
+	}
+
+	read := f.reads[0]
+	f.reads = f.reads[1:]
+
+	return copy(p, read.data), read.err
+}
+
+func (f *fakeInput) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	return nil
+}
+
+func (f *fakeInput) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.closed
+}
+
+func newTestReconnectReader(r io.ReadCloser, open func() (io.ReadCloser, error), reconnectOnEOF bool) *reconnectReader {
+	return &reconnectReader{
+		open: open,
+		name: "test",
+		options: &ReconnectOptions{
+			Enabled:    true,
+			MinBackoff: time.Millisecond,
+			MaxBackoff: 8 * time.Millisecond,
+		},
+		reconnectOnEOF: reconnectOnEOF,
+
+		r:       r,
+		backoff: time.Millisecond,
+		done:    make(chan struct{}),
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	errDisconnected := errors.New("disconnected")
+
+	first := &fakeInput{reads: []fakeRead{{data: "a"}, {err: errDisconnected}}}
+	second := &fakeInput{reads: []fakeRead{{data: "b"}, {err: errDisconnected}}}
+
+	var r *reconnectReader
+	var backoffs []time.Duration
+	r = newTestReconnectReader(first, func() (io.ReadCloser, error) {
+		r.mu.Lock()
+		backoffs = append(backoffs, r.backoff)
+		r.mu.Unlock()
+
+		if len(backoffs) < 4 {
+			return nil, errDisconnected
+		}
+		return second, nil
+	}, true)
+
+	buf := make([]byte, 16)
+	for _, expected := range []string{"a", "b"} {
+		n, err := r.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != expected {
+			t.Errorf("expected %q, got %q", expected, buf[:n])
+		}
+	}
+
+	// The backoff is doubled before each attempt up to the maximum
+	expected := []time.Duration{2 * time.Millisecond, 4 * time.Millisecond, 8 * time.Millisecond, 8 * time.Millisecond}
+	if len(backoffs) != len(expected) {
+		t.Fatalf("expected %d attempts to reopen, got %d", len(expected), len(backoffs))
+	}
+	for i := range expected {
+		if backoffs[i] != expected[i] {
+			t.Errorf("expected backoff %v before attempt %d, got %v", expected[i], i, backoffs[i])
+		}
+	}
+
+	if !first.isClosed() {
+		t.Error("expected the failed input to be closed")
+	}
+
+	if reconnects := Reconnects(r); reconnects != 1 {
+		t.Errorf("expected 1 reconnect, got %d", reconnects)
+	}
+
+	// Reading data resets the backoff
+	if r.backoff != r.options.MinBackoff {
+		t.Errorf("expected backoff to be reset to %v, got %v", r.options.MinBackoff, r.backoff)
+	}
+}
+
+func TestReconnectEOF(t *testing.T) {
+	t.Run("end of input", func(t *testing.T) {
+		input := &fakeInput{reads: []fakeRead{{data: "a"}}}
+		r := newTestReconnectReader(input, func() (io.ReadCloser, error) {
+			t.Error("expected input not to be reopened")
+			return nil, errors.New("unexpected open")
+		}, false)
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "a" {
+			t.Errorf("expected %q, got %q", "a", data)
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		input := &fakeInput{reads: []fakeRead{{data: "a"}}}
+		var opens int
+		r := newTestReconnectReader(input, func() (io.ReadCloser, error) {
+			opens++
+			return &fakeInput{reads: []fakeRead{{data: "b"}}}, nil
+		}, true)
+
+		buf := make([]byte, 16)
+		for _, expected := range []string{"a", "b"} {
+			n, err := r.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf[:n]) != expected {
+				t.Errorf("expected %q, got %q", expected, buf[:n])
+			}
+		}
+
+		if opens != 1 {
+			t.Errorf("expected input to be reopened once, got %d", opens)
+		}
+	})
+}
+
+func TestReconnectCloseDuringBackoff(t *testing.T) {
+	input := &fakeInput{reads: []fakeRead{{err: errors.New("disconnected")}}}
+	r := newTestReconnectReader(input, func() (io.ReadCloser, error) {
+		t.Error("expected input not to be reopened")
+		return nil, errors.New("unexpected open")
+	}, true)
+	r.backoff = time.Hour
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 16))
+		errs <- err
+	}()
+
+	// Wait until the reader is waiting for the backoff
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		if input.isClosed() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the input to be closed")
+		}
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, os.ErrClosed) {
+			t.Errorf("expected %v, got %v", os.ErrClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for Read to return after Close")
+	}
+
+	if _, err := r.Read(make([]byte, 16)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected %v after Close, got %v", os.ErrClosed, err)
+	}
+}
+
+func TestReconnectInvalidBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		minBackoff time.Duration
+		maxBackoff time.Duration
+	}{
+		{name: "zero minimum", minBackoff: 0, maxBackoff: time.Minute},
+		{name: "negative minimum", minBackoff: -time.Second, maxBackoff: time.Minute},
+		{name: "minimum above maximum", minBackoff: time.Minute, maxBackoff: time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := Open(&Options{
+				InputType: Stdin,
+				Reconnect: &ReconnectOptions{
+					Enabled:    true,
+					MinBackoff: test.minBackoff,
+					MaxBackoff: test.maxBackoff,
+				},
+			})
+			if err == nil {
+				r.Close()
+				t.Fatal("expected error for invalid backoff")
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package serialinput
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/jacobsa/go-serial/serial"
+)
+
+// Telnet commands and options, see RFC 854, RFC 856, RFC 858 and RFC 2217.
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptionBinary          = 0
+	telnetOptionSuppressGoAhead = 3
+	telnetOptionComPort         = 44
+
+	comPortSetBaudRate = 1
+	comPortSetDataSize = 2
+	comPortSetParity   = 3
+	comPortSetStopSize = 4
+	comPortSetControl  = 5
+
+	comPortParityNone = 1
+	comPortParityOdd  = 2
+	comPortParityEven = 3
+
+	comPortControlNoFlowControl = 1
+)
+
+type telnetState int
+
+const (
+	telnetStateData telnetState = iota
+	telnetStateIAC
+	telnetStateOption
+	telnetStateSubnegotiation
+	telnetStateSubnegotiationIAC
+)
+
+// openRFC2217 negotiates the serial settings with an RFC 2217 server, such as ser2net in telnet mode, and returns a
+// reader of the serial data with all telnet control sequences stripped.
+func openRFC2217(conn io.ReadWriteCloser, opts *SerialOptions) (io.ReadCloser, error) {
+	r := &telnetReader{
+		conn: conn,
+		buf:  make([]byte, 4096),
+		sent: make(map[[2]byte]bool),
+	}
+
+	var negotiation []byte
+	for _, option := range [][2]byte{
+		{telnetWILL, telnetOptionComPort},
+		{telnetWILL, telnetOptionBinary},
+		{telnetDO, telnetOptionBinary},
+		{telnetWILL, telnetOptionSuppressGoAhead},
+		{telnetDO, telnetOptionSuppressGoAhead},
+	} {
+		negotiation = append(negotiation, telnetIAC, option[0], option[1])
+		r.sent[option] = true
+	}
+
+	settings, err := comPortSettings(opts)
+	if err != nil {
+		return nil, err
+	}
+	negotiation = append(negotiation, settings...)
+
+	if _, err := conn.Write(negotiation); err != nil {
+		return nil, fmt.Errorf("failed to negotiate serial settings: %w", err)
+	}
+
+	return r, nil
+}
+
+// comPortSettings returns the RFC 2217 commands to set the baud rate, data bits, parity and stop bits.
+func comPortSettings(opts *SerialOptions) ([]byte, error) {
+	var parity byte
+	switch serial.ParityMode(opts.ParityMode) {
+	case serial.PARITY_NONE:
+		parity = comPortParityNone
+	case serial.PARITY_ODD:
+		parity = comPortParityOdd
+	case serial.PARITY_EVEN:
+		parity = comPortParityEven
+	default:
+		return nil, fmt.Errorf("unsupported parity mode %v", opts.ParityMode.String())
+	}
+
+	var stopSize byte
+	switch opts.StopBits {
+	case 1, 2:
+		stopSize = byte(opts.StopBits)
+	default:
+		return nil, fmt.Errorf("unsupported number of stop bits %d", opts.StopBits)
+	}
+
+	baudRate := make([]byte, 4)
+	binary.BigEndian.PutUint32(baudRate, uint32(opts.BaudRate))
+
+	var b []byte
+	b = appendComPortCommand(b, comPortSetBaudRate, baudRate...)
+	b = appendComPortCommand(b, comPortSetDataSize, byte(opts.DataBits))
+	b = appendComPortCommand(b, comPortSetParity, parity)
+	b = appendComPortCommand(b, comPortSetStopSize, stopSize)
+	b = appendComPortCommand(b, comPortSetControl, comPortControlNoFlowControl)
+
+	return b, nil
+}
+
+func appendComPortCommand(b []byte, command byte, value ...byte) []byte {
+	b = append(b, telnetIAC, telnetSB, telnetOptionComPort, command)
+	for _, v := range value {
+		b = append(b, v)
+		if v == telnetIAC {
+			b = append(b, telnetIAC)
+		}
+	}
+	return append(b, telnetIAC, telnetSE)
+}
+
+// telnetReader strips telnet control sequences from the data and answers option requests of the server.
+type telnetReader struct {
+	conn io.ReadWriteCloser
+	buf  []byte
+
+	state telnetState
+	verb  byte
+
+	// sent contains the option requests that were sent, so requests are only answered once
+	sent map[[2]byte]bool
+}
+
+func (r *telnetReader) Read(p []byte) (int, error) {
+	// Reading 0 bytes from the connection would return 0 bytes without an error forever
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for {
+		// Stripping control sequences only removes bytes, so the data always fits in p
+		n, err := r.conn.Read(r.buf[:min(len(p), len(r.buf))])
+
+		out, filterErr := r.filter(r.buf[:n], p)
+		if filterErr != nil {
+			return out, filterErr
+		}
+
+		if out > 0 || err != nil {
+			return out, err
+		}
+	}
+}
+
+func (r *telnetReader) filter(data, p []byte) (int, error) {
+	var n int
+
+	for _, b := range data {
+		switch r.state {
+		case telnetStateData:
+			if b == telnetIAC {
+				r.state = telnetStateIAC
+				continue
+			}
+			p[n] = b
+			n++
+		case telnetStateIAC:
+			switch b {
+			case telnetIAC:
+				p[n] = b
+				n++
+				r.state = telnetStateData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				r.verb = b
+				r.state = telnetStateOption
+			case telnetSB:
+				r.state = telnetStateSubnegotiation
+			default:
+				// Other commands, such as NOP and GA, have no meaning for the serial data
+				r.state = telnetStateData
+			}
+		case telnetStateOption:
+			r.state = telnetStateData
+			if err := r.negotiate(r.verb, b); err != nil {
+				return n, err
+			}
+		case telnetStateSubnegotiation:
+			// The responses of the server to the serial settings are ignored
+			if b == telnetIAC {
+				r.state = telnetStateSubnegotiationIAC
+			}
+		case telnetStateSubnegotiationIAC:
+			if b == telnetSE {
+				r.state = telnetStateData
+			} else {
+				r.state = telnetStateSubnegotiation
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// negotiate answers an option request of the server, accepting the options that were requested by us and refusing
+// all others.
+func (r *telnetReader) negotiate(verb, option byte) error {
+	var answer byte
+
+	switch verb {
+	case telnetDO:
+		answer = telnetWONT
+		if option == telnetOptionComPort || option == telnetOptionBinary || option == telnetOptionSuppressGoAhead {
+			answer = telnetWILL
+		}
+	case telnetWILL:
+		answer = telnetDONT
+		if option == telnetOptionBinary || option == telnetOptionSuppressGoAhead {
+			answer = telnetDO
+		}
+	default:
+		return nil
+	}
+
+	key := [2]byte{answer, option}
+	if r.sent[key] {
+		return nil
+	}
+	r.sent[key] = true
+
+	if _, err := r.conn.Write([]byte{telnetIAC, answer, option}); err != nil {
+		return fmt.Errorf("failed to answer telnet option %d: %w", option, err)
+	}
+
+	return nil
+}
+
+func (r *telnetReader) Close() error {
+	return r.conn.Close()
+}
@@ -0,0 +1,94 @@
+package serialinput_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+	"github.com/koesie10/smartmeter/serialinput"
+	"github.com/koesie10/smartmeter/smartmeter"
+)
+
+func TestRFC2217(t *testing.T) {
+	telegram, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// The server requests the echo option, acknowledges the baud rate and sends a NOP in the middle of the telegram
+		middle := len(telegram) / 2
+		var data []byte
+		data = append(data, 255, 253, 1)
+		data = append(data, 255, 250, 44, 101, 0, 1, 194, 0, 255, 240)
+		data = append(data, telegram[:middle]...)
+		data = append(data, 255, 241)
+		data = append(data, telegram[middle:]...)
+		if _, err := conn.Write(data); err != nil {
+			return
+		}
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buf, _ := io.ReadAll(conn)
+		received <- buf
+	}()
+
+	r, err := serialinput.OpenNetwork(&serialinput.NetworkOptions{
+		Type:        "tcp",
+		Address:     l.Addr().String(),
+		DialTimeout: time.Second,
+		ReadTimeout: time.Second,
+		RFC2217:     true,
+	}, &serialinput.SerialOptions{
+		BaudRate:   115200,
+		DataBits:   8,
+		StopBits:   1,
+		ParityMode: serialinput.ParityMode(serial.PARITY_NONE),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm, err := smartmeter.New(r, smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sm.Read(); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	negotiation := <-received
+
+	for name, expected := range map[string][]byte{
+		"com port option": {255, 251, 44},
+		"baud rate":       {255, 250, 44, 1, 0, 1, 194, 0, 255, 240},
+		"data size":       {255, 250, 44, 2, 8, 255, 240},
+		"parity":          {255, 250, 44, 3, 1, 255, 240},
+		"stop size":       {255, 250, 44, 4, 1, 255, 240},
+		"refused echo":    {255, 252, 1},
+	} {
+		if !bytes.Contains(negotiation, expected) {
+			t.Errorf("expected %s %v in negotiation %v", name, expected, negotiation)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package serialinput
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/jacobsa/go-serial/serial"
 	"io"
+	"log"
 	"strings"
+	"time"
 )
 
 type SerialOptions struct {
@@ -13,9 +17,32 @@ type SerialOptions struct {
 	DataBits   uint       `env:"SERIAL_DATA_BITS" flag:"data-bits" desc:"data bits"`
 	StopBits   uint       `env:"SERIAL_STOP_BITS" flag:"stop-bits" desc:"stop bits"`
 	ParityMode ParityMode `env:"SERIAL_PARITY_MODE" flag:"parity-mode" desc:"parity mode"`
+
+	Auto        bool          `env:"SERIAL_AUTO" flag:"auto" desc:"detect whether the meter uses the serial settings of DSMR 4/5 (115200 8N1) or DSMR 2.2/3 (9600 7E1), overriding the baud rate, data bits, stop bits and parity mode"`
+	AutoTimeout time.Duration `env:"SERIAL_AUTO_TIMEOUT" flag:"auto-timeout" desc:"time to wait for a telegram with each of the serial settings when detecting them"`
+}
+
+// serialProfile contains the serial settings used by meters of a DSMR version.
+type serialProfile struct {
+	name       string
+	baudRate   uint
+	dataBits   uint
+	stopBits   uint
+	parityMode serial.ParityMode
+}
+
+var serialProfiles = []serialProfile{
+	{name: "DSMR 4/5 (115200 8N1)", baudRate: 115200, dataBits: 8, stopBits: 1, parityMode: serial.PARITY_NONE},
+	{name: "DSMR 2.2/3 (9600 7E1)", baudRate: 9600, dataBits: 7, stopBits: 1, parityMode: serial.PARITY_EVEN},
 }
 
 func OpenSerial(opts *SerialOptions) (io.ReadCloser, error) {
+	if opts.Auto {
+		if err := detectSerial(opts, probeSerial); err != nil {
+			return nil, err
+		}
+	}
+
 	openOptions := serial.OpenOptions{
 		PortName:        opts.Port,
 		BaudRate:        opts.BaudRate,
@@ -33,6 +60,116 @@ func OpenSerial(opts *SerialOptions) (io.ReadCloser, error) {
 	return port, nil
 }
 
+// detectSerial tries the settings of all serial profiles with probePort until a telegram is received and stores the
+// working settings in opts, so the port is opened with the same settings when it is opened again.
+func detectSerial(opts *SerialOptions, probePort func(portName string, profile serialProfile, timeout time.Duration) (bool, error)) error {
+	for _, profile := range serialProfiles {
+		ok, err := probePort(opts.Port, profile, opts.AutoTimeout)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			log.Printf("No telegram received on %s with %s", opts.Port, profile.name)
+			continue
+		}
+
+		log.Printf("Detected %s on %s", profile.name, opts.Port)
+
+		opts.BaudRate = profile.baudRate
+		opts.DataBits = profile.dataBits
+		opts.StopBits = profile.stopBits
+		opts.ParityMode = ParityMode(profile.parityMode)
+		opts.Auto = false
+
+		return nil
+	}
+
+	return fmt.Errorf("failed to detect serial settings of %s: no telegram received with any of the known settings", opts.Port)
+}
+
+// probeSerial reads from the port with the settings of the profile until a telegram is received or the timeout expires.
+func probeSerial(portName string, profile serialProfile, timeout time.Duration) (bool, error) {
+	port, err := serial.Open(serial.OpenOptions{
+		PortName:   portName,
+		BaudRate:   profile.baudRate,
+		DataBits:   profile.dataBits,
+		StopBits:   profile.stopBits,
+		ParityMode: profile.parityMode,
+		// Reads return after 100ms without data, so the timeout can be checked
+		InterCharacterTimeout: 100,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to open serial port %s: %w", portName, err)
+	}
+	defer port.Close()
+
+	ok, err := probe(port, timeout)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from serial port %s: %w", portName, err)
+	}
+
+	return ok, nil
+}
+
+// probe reads from r until a telegram is received or the timeout expires. Reads from r must return regularly, even
+// when no data is available, so the timeout can be checked.
+func probe(r io.Reader, timeout time.Duration) (bool, error) {
+	var data []byte
+	buf := make([]byte, 1024)
+
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		n, err := r.Read(buf)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, err
+		}
+
+		data = append(data, buf[:n]...)
+		if containsTelegram(data) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// containsTelegram returns whether the data contains a telegram from / up to !. With the wrong serial settings, the
+// data is garbage, which may contain a / and ! by chance but not the text of a telegram in between.
+func containsTelegram(data []byte) bool {
+	for {
+		start := bytes.IndexByte(data, '/')
+		if start < 0 {
+			return false
+		}
+		data = data[start:]
+
+		end := bytes.IndexByte(data, '!')
+		if end < 0 {
+			return false
+		}
+
+		if isTelegramText(data[:end]) {
+			return true
+		}
+
+		data = data[1:]
+	}
+}
+
+func isTelegramText(data []byte) bool {
+	if !bytes.Contains(data, []byte("\r\n")) || !bytes.Contains(data, []byte(")\r\n")) {
+		return false
+	}
+
+	for _, b := range data {
+		if (b < 0x20 || b > 0x7E) && b != '\r' && b != '\n' {
+			return false
+		}
+	}
+
+	return true
+}
+
 type ParityMode serial.ParityMode
 
 func (m *ParityMode) String() string {
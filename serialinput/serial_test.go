@@ -0,0 +1,195 @@
+package serialinput
+
+import (
+	"bytes"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+)
+
+// as8N1 returns the data as read by a port configured for 8N1 when the meter sends 7E1: the even parity bit is read
+// as the eighth data bit.
+func as8N1(data []byte) []byte {
+	result := make([]byte, len(data))
+	for i, b := range data {
+		result[i] = b & 0x7F
+		if bits.OnesCount8(b&0x7F)%2 == 1 {
+			result[i] |= 0x80
+		}
+	}
+	return result
+}
+
+func TestContainsTelegram(t *testing.T) {
+	telegram, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "dsmr22.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected bool
+	}{
+		{name: "telegram", data: telegram, expected: true},
+		{name: "telegram after garbage", data: append([]byte("\x00\xff/!\r\n"), telegram...), expected: true},
+		{name: "7E1 read as 8N1", data: as8N1(telegram), expected: false},
+		{name: "noise with / and !", data: []byte("\x13/\x7f\xfe(\r\n\x80!\x00/ab)\r\n\x9c!"), expected: false},
+		{name: "partial telegram", data: telegram[:len(telegram)/2], expected: false},
+		{name: "no start", data: telegram[1:], expected: false},
+		{name: "empty", data: nil, expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := containsTelegram(test.data); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIsTelegramText(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected bool
+	}{
+		{name: "lines", data: "/ISk5\\2MT382-1000\r\n\r\n1-0:1.8.1(000001.000*kWh)\r\n", expected: true},
+		{name: "no line endings", data: "/ISk5\\2MT382-1000", expected: false},
+		{name: "no values", data: "/ISk5\\2MT382-1000\r\n\r\n", expected: false},
+		{name: "line feeds only", data: "/ISk5\\2MT382-1000\n1-0:1.8.1(000001.000*kWh)\n", expected: false},
+		{name: "control character", data: "/ISk5\\2MT382-1000\r\n\x021-0:1.8.1(000001.000*kWh)\r\n", expected: false},
+		{name: "high bit", data: "/ISk5\\2MT382-1000\r\n1-0:1.8.1(\xb0\xb0\xb0001.000*kWh)\r\n", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := isTelegramText([]byte(test.data)); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+// chunkReader returns the data in chunks of at most size bytes, like a serial port that receives data slowly.
+type chunkReader struct {
+	data []byte
+	size int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p[:min(len(p), r.size)], r.data)
+	r.data = r.data[n:]
+
+	return n, nil
+}
+
+func TestProbe(t *testing.T) {
+	telegram, err := os.ReadFile(filepath.Join("..", "smartmeter", "test", "dsmr22.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected bool
+	}{
+		{name: "telegram", data: telegram, expected: true},
+		{name: "telegram after partial telegram", data: append(telegram[len(telegram)/2:], telegram...), expected: true},
+		{name: "7E1 read as 8N1", data: bytes.Repeat(as8N1(telegram), 2), expected: false},
+		{name: "partial telegram", data: telegram[:len(telegram)-3], expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := probe(&chunkReader{data: test.data, size: 16}, 50*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDetectSerial(t *testing.T) {
+	opts := &SerialOptions{
+		Port:        filepath.Join(t.TempDir(), "missing"),
+		Auto:        true,
+		AutoTimeout: 50 * time.Millisecond,
+	}
+
+	if err := detectSerial(opts, probeSerial); err == nil {
+		t.Fatal("expected error for missing port")
+	}
+
+	if !opts.Auto || opts.BaudRate != 0 {
+		t.Errorf("expected options to be unchanged, got %+v", opts)
+	}
+}
+
+func TestDetectSerialProfile(t *testing.T) {
+	tests := []struct {
+		name       string
+		parityMode serial.ParityMode
+		baudRate   uint
+		dataBits   uint
+		probes     int
+	}{
+		{name: "DSMR 4/5", parityMode: serial.PARITY_NONE, baudRate: 115200, dataBits: 8, probes: 1},
+		{name: "DSMR 2.2/3", parityMode: serial.PARITY_EVEN, baudRate: 9600, dataBits: 7, probes: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := &SerialOptions{
+				Port:        "/dev/ttyUSB0",
+				BaudRate:    115200,
+				DataBits:    8,
+				StopBits:    2,
+				ParityMode:  ParityMode(serial.PARITY_ODD),
+				Auto:        true,
+				AutoTimeout: time.Second,
+			}
+
+			// The meter only sends telegrams that can be read with its own settings
+			var probes int
+			probe := func(portName string, profile serialProfile, timeout time.Duration) (bool, error) {
+				probes++
+				if portName != opts.Port || timeout != opts.AutoTimeout {
+					t.Errorf("unexpected probe of %s with timeout %v", portName, timeout)
+				}
+				return profile.parityMode == test.parityMode, nil
+			}
+
+			if err := detectSerial(opts, probe); err != nil {
+				t.Fatal(err)
+			}
+
+			if probes != test.probes {
+				t.Errorf("expected %d probes, got %d", test.probes, probes)
+			}
+			if opts.BaudRate != test.baudRate || opts.DataBits != test.dataBits || opts.StopBits != 1 || opts.ParityMode != ParityMode(test.parityMode) {
+				t.Errorf("expected %d baud, %d data bits, 1 stop bit and parity %v, got %+v", test.baudRate, test.dataBits, test.parityMode, opts)
+			}
+
+			// The detected settings are used when the port is reopened
+			if opts.Auto {
+				t.Error("expected detection to be disabled after detecting the settings")
+			}
+		})
+	}
+}
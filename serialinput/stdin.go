@@ -0,0 +1,11 @@
+package serialinput
+
+import (
+	"io"
+	"os"
+)
+
+// OpenStdin returns stdin as input, so telegrams can be piped from other programs such as socat, ssh or picocom.
+func OpenStdin() (io.ReadCloser, error) {
+	return os.Stdin, nil
+}
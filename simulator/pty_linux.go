@@ -0,0 +1,100 @@
+//go:build linux
+
+package simulator
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenPTY opens a pseudo-terminal and returns a writer to its master side and the name of its slave device, which can
+// be opened as a serial port by the reader. Writes that block for longer than timeout, for example because nobody is
+// reading from the slave device, fail with os.ErrDeadlineExceeded.
+func OpenPTY(timeout time.Duration) (*PTY, string, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open pseudo-terminal: %w", err)
+	}
+
+	// The ioctls are done through the raw connection, since calling Fd would put the file in blocking mode and disable
+	// write deadlines
+	rawConn, err := master.SyscallConn()
+	if err != nil {
+		master.Close()
+		return nil, "", fmt.Errorf("failed to get pseudo-terminal connection: %w", err)
+	}
+
+	var n int
+	var ioctlErr error
+	err = rawConn.Control(func(fd uintptr) {
+		if ioctlErr = unix.IoctlSetPointerInt(int(fd), unix.TIOCSPTLCK, 0); ioctlErr != nil {
+			return
+		}
+		n, ioctlErr = unix.IoctlGetInt(int(fd), unix.TIOCGPTN)
+	})
+	if err == nil {
+		err = ioctlErr
+	}
+	if err != nil {
+		master.Close()
+		return nil, "", fmt.Errorf("failed to unlock pseudo-terminal: %w", err)
+	}
+	name := fmt.Sprintf("/dev/pts/%d", n)
+
+	// The slave is kept open, so the terminal settings are kept and writes do not fail while nobody has opened it
+	slave, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, "", fmt.Errorf("failed to open %s: %w", name, err)
+	}
+
+	if err := makeRaw(int(slave.Fd())); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, "", fmt.Errorf("failed to set %s to raw mode: %w", name, err)
+	}
+
+	return &PTY{
+		master:  master,
+		slave:   slave,
+		timeout: timeout,
+	}, name, nil
+}
+
+// makeRaw disables all input and output processing, so the telegrams are passed through unchanged.
+func makeRaw(fd int) error {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+
+	return unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+}
+
+type PTY struct {
+	master  *os.File
+	slave   *os.File
+	timeout time.Duration
+}
+
+func (p *PTY) Write(b []byte) (int, error) {
+	// Not all kernels support polling pseudo-terminals, in which case the write blocks without a deadline
+	_ = p.master.SetWriteDeadline(time.Now().Add(p.timeout))
+
+	return p.master.Write(b)
+}
+
+func (p *PTY) Close() error {
+	p.slave.Close()
+	return p.master.Close()
+}
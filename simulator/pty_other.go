@@ -0,0 +1,23 @@
+//go:build !linux
+
+package simulator
+
+import (
+	"errors"
+	"time"
+)
+
+// OpenPTY is only supported on Linux.
+func OpenPTY(timeout time.Duration) (*PTY, string, error) {
+	return nil, "", errors.New("pseudo-terminals are only supported on Linux")
+}
+
+type PTY struct{}
+
+func (p *PTY) Write(b []byte) (int, error) {
+	return 0, errors.New("pseudo-terminals are only supported on Linux")
+}
+
+func (p *PTY) Close() error {
+	return nil
+}
@@ -0,0 +1,307 @@
+// Package simulator generates realistic telegrams of a smart meter, which can be used to run the rest of the pipeline
+// without a meter.
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/koesie10/smartmeter/smartmeter"
+)
+
+// maxPowerFailureEvents is the number of long power failures that is kept in the power failure event log
+const maxPowerFailureEvents = 10
+
+type Options struct {
+	DSMRVersion smartmeter.Version `env:"SIMULATE_DSMR_VERSION" flag:"dsmr-version" desc:"DSMR version of the telegrams: 2.2, 4 or 5"`
+	Phases      int                `env:"SIMULATE_PHASES" flag:"phases" desc:"number of phases of the meter"`
+	Interval    time.Duration      `env:"SIMULATE_INTERVAL" flag:"interval" desc:"interval between telegrams, defaults to 10s for DSMR 2.2 and 4 and 1s for DSMR 5"`
+	Timezone    string             `env:"SIMULATE_TIMEZONE" flag:"timezone" desc:"IANA timezone of the meter, defaults to Europe/Amsterdam"`
+
+	SolarPeak            float64       `env:"SIMULATE_SOLAR_PEAK" flag:"solar-peak" desc:"peak production of the solar panels in kW, 0 to disable solar production"`
+	PowerFailureInterval time.Duration `env:"SIMULATE_POWER_FAILURE_INTERVAL" flag:"power-failure-interval" desc:"average time between power failures, 0 to disable power failures"`
+
+	Seed int64 `env:"SIMULATE_SEED" flag:"seed" desc:"seed of the random generator, 0 to use a random seed"`
+}
+
+// Generator generates the packets of a simulated meter. The meter readings only increase between packets.
+type Generator struct {
+	options  Options
+	location *time.Location
+	rand     *rand.Rand
+
+	last   time.Time
+	packet smartmeter.P1Packet
+
+	// gas is the actual gas reading, while the gas reading in the packet is only updated at the gas interval
+	gas float64
+}
+
+func NewGenerator(options Options) (*Generator, error) {
+	if options.DSMRVersion == smartmeter.VersionFromPacket {
+		options.DSMRVersion = smartmeter.DSMR5
+	}
+	if options.Phases < 1 || options.Phases > 3 {
+		return nil, fmt.Errorf("invalid number of phases %d, must be 1, 2 or 3", options.Phases)
+	}
+	if options.Interval <= 0 {
+		options.Interval = 10 * time.Second
+		if options.DSMRVersion == smartmeter.DSMR5 {
+			options.Interval = time.Second
+		}
+	}
+	if options.Timezone == "" {
+		options.Timezone = smartmeter.DefaultTimezone
+	}
+
+	location, err := time.LoadLocation(options.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", options.Timezone, err)
+	}
+
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	g := &Generator{
+		options:  options,
+		location: location,
+		rand:     rand.New(rand.NewSource(seed)),
+		gas:      1234.567,
+	}
+
+	g.packet = smartmeter.P1Packet{
+		Electricity: smartmeter.Electricity{
+			EquipmentID:    "4530303033303030303030303030303030",
+			SwitchPosition: 1,
+			Tariffs: []smartmeter.Tariff{
+				{Number: 1, Consumed: 4321.123, Produced: 1234.321},
+				{Number: 2, Consumed: 3456.234, Produced: 2345.432},
+			},
+			Phases: make([]smartmeter.Phase, options.Phases),
+		},
+		MBus: []smartmeter.MBusDevice{
+			{
+				Channel:       1,
+				DeviceType:    smartmeter.MBusDeviceTypeGas,
+				EquipmentID:   "4730303032333430313233343536373839",
+				Unit:          "m3",
+				Value:         g.gas,
+				ValvePosition: 1,
+			},
+		},
+	}
+
+	for i := range g.packet.Electricity.Phases {
+		g.packet.Electricity.Phases[i].Number = i + 1
+	}
+
+	switch options.DSMRVersion {
+	case smartmeter.DSMR22:
+		g.packet.Electricity.Threshold = 999
+		g.packet.Electricity.ThresholdUnit = "A"
+	case smartmeter.DSMR4:
+		g.packet.DSMRVersion = "42"
+		g.packet.Electricity.Threshold = 999.9
+		g.packet.Electricity.ThresholdUnit = "kW"
+	default:
+		g.packet.DSMRVersion = "50"
+	}
+
+	return g, nil
+}
+
+// Interval returns the interval between telegrams.
+func (g *Generator) Interval() time.Duration {
+	return g.options.Interval
+}
+
+// Next returns the packet of the meter at t, updating the meter readings for the time since the previous packet.
+func (g *Generator) Next(t time.Time) *smartmeter.P1Packet {
+	t = t.Truncate(time.Second).In(g.location)
+
+	var elapsed time.Duration
+	if !g.last.IsZero() && t.After(g.last) {
+		elapsed = t.Sub(g.last)
+	}
+	g.last = t
+
+	p := &g.packet
+	p.Timestamp = t
+
+	consumption := g.consumption(t)
+	production := g.solarProduction(t)
+
+	// The solar panels are connected to the first phase
+	phaseConsumption := make([]float64, len(p.Electricity.Phases))
+	for i := range phaseConsumption {
+		phaseConsumption[i] = consumption / float64(len(phaseConsumption)) * (0.8 + 0.4*g.rand.Float64())
+	}
+	phaseProduction := make([]float64, len(p.Electricity.Phases))
+	phaseProduction[0] = production
+
+	p.Electricity.CurrentConsumed = 0
+	p.Electricity.CurrentProduced = 0
+	for i := range p.Electricity.Phases {
+		phase := &p.Electricity.Phases[i]
+
+		net := phaseConsumption[i] - phaseProduction[i]
+		phase.InstantaneousActivePositivePower = round(math.Max(net, 0), 3)
+		phase.InstantaneousActiveNegativePower = round(math.Max(-net, 0), 3)
+		phase.InstantaneousVoltage = round(230+g.rand.NormFloat64()*2, 1)
+		phase.InstantaneousCurrent = math.Round(math.Abs(net) * 1000 / phase.InstantaneousVoltage)
+
+		p.Electricity.CurrentConsumed += phase.InstantaneousActivePositivePower
+		p.Electricity.CurrentProduced += phase.InstantaneousActiveNegativePower
+	}
+
+	tariff := g.tariff(t)
+	p.Electricity.Tariff = tariff + 1
+	p.Electricity.Tariffs[tariff].Consumed += p.Electricity.CurrentConsumed * elapsed.Hours()
+	p.Electricity.Tariffs[tariff].Produced += p.Electricity.CurrentProduced * elapsed.Hours()
+
+	g.gas += g.gasConsumption(t) * elapsed.Hours()
+
+	// Gas meters only send their reading every hour, or every 5 minutes since DSMR 5
+	gasInterval := time.Hour
+	if g.options.DSMRVersion == smartmeter.DSMR5 {
+		gasInterval = 5 * time.Minute
+	}
+	if measuredAt := t.Truncate(gasInterval); !measuredAt.Equal(p.MBus[0].MeasuredAt) {
+		p.MBus[0].MeasuredAt = measuredAt
+		p.MBus[0].Value = round(g.gas, 3)
+	}
+	p.Gas = smartmeter.Gas{
+		EquipmentID:   p.MBus[0].EquipmentID,
+		DeviceType:    p.MBus[0].DeviceType,
+		Consumed:      p.MBus[0].Value,
+		MeasuredAt:    p.MBus[0].MeasuredAt,
+		ValvePosition: p.MBus[0].ValvePosition,
+	}
+
+	if g.options.PowerFailureInterval > 0 && g.rand.Float64() < float64(elapsed)/float64(g.options.PowerFailureInterval) {
+		g.powerFailure(t)
+	}
+
+	return g.copyPacket()
+}
+
+// consumption returns the household consumption in kW, with peaks in the morning and evening.
+func (g *Generator) consumption(t time.Time) float64 {
+	hour := float64(t.Hour()) + float64(t.Minute())/60
+
+	consumption := 0.25 + 0.5*math.Exp(-math.Pow(hour-7.5, 2)) + 1.2*math.Exp(-math.Pow(hour-18.5, 2)/2)
+	consumption *= 0.8 + 0.4*g.rand.Float64()
+
+	// Occasionally, a kettle or an oven is turned on
+	if g.rand.Float64() < 0.02 {
+		consumption += 2
+	}
+
+	return consumption
+}
+
+// solarProduction returns the production of the solar panels in kW, which follows the sun between 06:00 and 18:00.
+func (g *Generator) solarProduction(t time.Time) float64 {
+	if g.options.SolarPeak <= 0 {
+		return 0
+	}
+
+	hour := float64(t.Hour()) + float64(t.Minute())/60
+	if hour < 6 || hour > 18 {
+		return 0
+	}
+
+	return g.options.SolarPeak * math.Sin(math.Pi*(hour-6)/12) * (0.85 + 0.15*g.rand.Float64())
+}
+
+// gasConsumption returns the gas consumption in m3/h, which is higher when the heating is on.
+func (g *Generator) gasConsumption(t time.Time) float64 {
+	if hour := t.Hour(); (hour >= 6 && hour < 9) || (hour >= 17 && hour < 22) {
+		return 0.3
+	}
+	return 0.05
+}
+
+// tariff returns the index of the tariff, which is the low tariff (1) during the night and in the weekend and the
+// normal tariff (2) otherwise.
+func (g *Generator) tariff(t time.Time) int {
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday || t.Hour() < 7 || t.Hour() >= 23 {
+		return 0
+	}
+	return 1
+}
+
+func (g *Generator) powerFailure(t time.Time) {
+	e := &g.packet.Electricity
+
+	e.NumberOfPowerFailures++
+
+	phase := &e.Phases[g.rand.Intn(len(e.Phases))]
+	phase.NumberOfVoltageSags++
+
+	// Most power failures are short, but some of them take a few minutes
+	duration := time.Duration(g.rand.ExpFloat64()*60) * time.Second
+	if duration < 3*time.Minute {
+		return
+	}
+
+	e.NumberOfLongPowerFailures++
+	e.PowerFailureEventLog = append(e.PowerFailureEventLog, smartmeter.PowerFailure{
+		Timestamp: t,
+		Duration:  duration,
+	})
+	if len(e.PowerFailureEventLog) > maxPowerFailureEvents {
+		e.PowerFailureEventLog = e.PowerFailureEventLog[1:]
+	}
+}
+
+func (g *Generator) copyPacket() *smartmeter.P1Packet {
+	p := g.packet
+
+	p.Electricity.Tariffs = append([]smartmeter.Tariff(nil), p.Electricity.Tariffs...)
+	p.Electricity.Phases = append([]smartmeter.Phase(nil), p.Electricity.Phases...)
+	p.Electricity.PowerFailureEventLog = append([]smartmeter.PowerFailure(nil), p.Electricity.PowerFailureEventLog...)
+	p.MBus = append([]smartmeter.MBusDevice(nil), p.MBus...)
+
+	return &p
+}
+
+// Run writes a telegram to w every interval until ctx is done. Telegrams that cannot be written before the next
+// telegram is due are dropped, like a meter does when nobody is reading.
+func (g *Generator) Run(ctx context.Context, w io.Writer) error {
+	encoder, err := smartmeter.NewEncoder(w, smartmeter.EncoderOptions{
+		Version:  g.options.DSMRVersion,
+		Timezone: g.options.Timezone,
+	})
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(g.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := encoder.Encode(g.Next(time.Now())); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func round(v float64, decimals int) float64 {
+	factor := math.Pow(10, float64(decimals))
+	return math.Round(v*factor) / factor
+}
@@ -0,0 +1,78 @@
+package simulator_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/koesie10/smartmeter/simulator"
+	"github.com/koesie10/smartmeter/smartmeter"
+)
+
+func TestGenerator(t *testing.T) {
+	for _, version := range []smartmeter.Version{smartmeter.DSMR22, smartmeter.DSMR4, smartmeter.DSMR5} {
+		generator, err := simulator.NewGenerator(simulator.Options{
+			DSMRVersion:          version,
+			Phases:               1,
+			Interval:             10 * time.Second,
+			SolarPeak:            3,
+			PowerFailureInterval: time.Hour,
+			Seed:                 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		encoder, err := smartmeter.NewEncoder(&buf, smartmeter.EncoderOptions{Version: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)
+
+		var previous *smartmeter.P1Packet
+		for ts := start; ts.Before(start.Add(24 * time.Hour)); ts = ts.Add(generator.Interval()) {
+			packet := generator.Next(ts)
+
+			if previous != nil {
+				for i, tariff := range packet.Electricity.Tariffs {
+					if tariff.Consumed < previous.Electricity.Tariffs[i].Consumed || tariff.Produced < previous.Electricity.Tariffs[i].Produced {
+						t.Fatalf("%v: tariff %d decreased at %v", version, i+1, ts)
+					}
+				}
+				if packet.Gas.Consumed < previous.Gas.Consumed {
+					t.Fatalf("%v: gas decreased at %v", version, ts)
+				}
+			}
+			previous = packet
+
+			buf.Reset()
+			if err := encoder.Encode(packet); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if previous.Electricity.Tariffs[1].Produced <= 2345.432 {
+			t.Errorf("%v: expected solar production on the longest day, got %+v", version, previous.Electricity.Tariffs)
+		}
+		if previous.Electricity.NumberOfPowerFailures == 0 {
+			t.Errorf("%v: expected power failures", version)
+		}
+
+		sm, err := smartmeter.New(&buf, smartmeter.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packet, err := sm.Read()
+		if err != nil {
+			t.Fatalf("%v: failed to parse generated telegram: %v", version, err)
+		}
+
+		if math.Abs(packet.Electricity.Tariffs[1].Consumed-previous.Electricity.Tariffs[1].Consumed) > 0.001 || packet.Gas.Consumed != previous.Gas.Consumed {
+			t.Errorf("%v: expected parsed telegram to match generated packet", version)
+		}
+	}
+}
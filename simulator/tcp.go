@@ -0,0 +1,80 @@
+package simulator
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// TCPWriter writes to all connections that are accepted on a listener. Connections that cannot keep up are closed.
+type TCPWriter struct {
+	l       net.Listener
+	timeout time.Duration
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func NewTCPWriter(l net.Listener, timeout time.Duration) *TCPWriter {
+	w := &TCPWriter{
+		l:       l,
+		timeout: timeout,
+		conns:   make(map[net.Conn]struct{}),
+	}
+
+	go w.accept()
+
+	return w
+}
+
+func (w *TCPWriter) accept() {
+	for {
+		conn, err := w.l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Failed to accept connection: %v", err)
+			continue
+		}
+
+		w.mu.Lock()
+		w.conns[conn] = struct{}{}
+		w.mu.Unlock()
+	}
+}
+
+func (w *TCPWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for conn := range w.conns {
+		if err := conn.SetWriteDeadline(time.Now().Add(w.timeout)); err == nil {
+			_, err = conn.Write(b)
+			if err == nil {
+				continue
+			}
+		}
+
+		conn.Close()
+		delete(w.conns, conn)
+	}
+
+	return len(b), nil
+}
+
+func (w *TCPWriter) Close() error {
+	err := w.l.Close()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for conn := range w.conns {
+		conn.Close()
+		delete(w.conns, conn)
+	}
+
+	return err
+}
@@ -0,0 +1,79 @@
+package smartmeter
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// crc16 calculates the CRC16/ARC checksum (polynomial 0xA001, reflected, initial value 0) that is used by
+// DSMR 4 and 5 telegrams.
+func crc16(data []byte) uint16 {
+	var crc uint16
+
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// verifyChecksum verifies the CRC16 of a raw telegram starting at / and ending with the !CRC line. Telegrams without a
+// checksum after the ! are only accepted as-is if they do not declare their version (DSMR 2.2 and 3), since the
+// checksum of DSMR 4 and 5 telegrams may be missing because the telegram was truncated.
+func verifyChecksum(telegram []byte) error {
+	start := bytes.IndexByte(telegram, '/')
+	end := bytes.LastIndexByte(telegram, '!')
+	if start < 0 || end < start {
+		return WrapError(fmt.Errorf("no start or end marker"), "telegram", string(telegram))
+	}
+
+	checksum := string(bytes.TrimSpace(telegram[end+1:]))
+	if checksum == "" {
+		if version, ok := declaredVersion(telegram[start:end]); ok {
+			return WrapError(fmt.Errorf("missing checksum of telegram with version %s", version), "checksum", string(bytes.TrimSpace(telegram[end:])))
+		}
+		return nil
+	}
+
+	expected, err := strconv.ParseUint(checksum, 16, 16)
+	if err != nil {
+		return WrapError(err, "checksum", checksum)
+	}
+
+	actual := crc16(telegram[start : end+1])
+	if actual != uint16(expected) {
+		return &ChecksumError{
+			Expected: uint16(expected),
+			Actual:   actual,
+		}
+	}
+
+	return nil
+}
+
+// declaredVersion returns the version of a telegram that declares its version, which is done by DSMR 4 and 5
+// (1-3:0.2.8) and e-MUCS (0-0:96.1.4) telegrams, which always have a checksum.
+func declaredVersion(telegram []byte) (string, bool) {
+	for _, line := range strings.Split(string(telegram), "\n") {
+		code, groups, ok := splitLine(strings.TrimSpace(line))
+		if !ok || len(groups) == 0 {
+			continue
+		}
+
+		switch code {
+		case "1-3:0.2.8", "0-0:96.1.4":
+			return groups[0], true
+		}
+	}
+
+	return "", false
+}
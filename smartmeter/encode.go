@@ -0,0 +1,514 @@
+package smartmeter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the version of DSMR that is used to encode a telegram.
+type Version int
+
+const (
+	// VersionFromPacket determines the version from the DSMRVersion of the packet: DSMR 2.2 if it is empty, DSMR 4 if
+	// it starts with a 4 and DSMR 5 otherwise. Packets of e-MUCS meters, which have an EMUCSVersion instead, are DSMR 5.
+	VersionFromPacket Version = iota
+	// DSMR22 is DSMR 2.2, which has no checksum and no timestamps.
+	DSMR22
+	// DSMR4 is DSMR 4.0 up to 4.2.2.
+	DSMR4
+	// DSMR5 is DSMR 5.0, which is also used by e-MUCS and Smarty meters.
+	DSMR5
+)
+
+func (v Version) String() string {
+	switch v {
+	case VersionFromPacket:
+		return "auto"
+	case DSMR22:
+		return "2.2"
+	case DSMR4:
+		return "4"
+	case DSMR5:
+		return "5"
+	}
+	return fmt.Sprintf("Version(%d)", int(v))
+}
+
+// Set implements pflag.Value.
+func (v *Version) Set(value string) error {
+	switch value {
+	case "auto":
+		*v = VersionFromPacket
+	case "2.2":
+		*v = DSMR22
+	case "4":
+		*v = DSMR4
+	case "5":
+		*v = DSMR5
+	default:
+		return fmt.Errorf("invalid DSMR version %q, must be auto, 2.2, 4 or 5", value)
+	}
+	return nil
+}
+
+// Type implements pflag.Value.
+func (v *Version) Type() string {
+	return "version"
+}
+
+type EncoderOptions struct {
+	// Version is the DSMR version of the telegrams
+	Version Version
+	// Timezone is the IANA timezone of the timestamps in the telegrams, defaults to DefaultTimezone
+	Timezone string
+}
+
+// Encoder writes packets as DSMR telegrams, in the format in which meters send them.
+type Encoder struct {
+	w io.Writer
+
+	options  EncoderOptions
+	location *time.Location
+}
+
+func NewEncoder(w io.Writer, options EncoderOptions) (*Encoder, error) {
+	timezone := options.Timezone
+	if timezone == "" {
+		timezone = DefaultTimezone
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+
+	return &Encoder{
+		w:        w,
+		options:  options,
+		location: location,
+	}, nil
+}
+
+// Encode writes the packet as a single telegram, including the CRC16 for DSMR 4 and 5. The objects that are written
+// are the ones defined by the DSMR version, followed by the Unknown and Extra objects of the packet. If the packet was
+// parsed from a telegram, objects keep the OBIS code and precision they had in that telegram, and objects that the
+// version does not define are written if that telegram contained them.
+func (e *Encoder) Encode(p *P1Packet) error {
+	version := e.options.Version
+	if version == VersionFromPacket {
+		version = versionOf(p)
+	}
+
+	te := telegramEncoder{
+		version:  version,
+		location: e.location,
+		original: originalObjects(p.Raw),
+	}
+	te.encode(p)
+
+	if _, err := e.w.Write(te.buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write telegram: %w", err)
+	}
+
+	return nil
+}
+
+func versionOf(p *P1Packet) Version {
+	switch {
+	case p.DSMRVersion == "" && p.EMUCSVersion != "":
+		// e-MUCS is based on DSMR 5, but does not send the DSMR version
+		return DSMR5
+	case p.DSMRVersion == "":
+		return DSMR22
+	case strings.HasPrefix(p.DSMRVersion, "4"):
+		return DSMR4
+	}
+	return DSMR5
+}
+
+// originalObjects returns the groups of the objects in the raw telegram of a packet, keyed by their OBIS code.
+func originalObjects(raw [][]byte) map[string][]string {
+	objects := make(map[string][]string)
+	for _, line := range joinContinuationLines(raw) {
+		if code, groups, ok := splitLine(line.text); ok {
+			objects[code] = groups
+		}
+	}
+	return objects
+}
+
+type telegramEncoder struct {
+	buf bytes.Buffer
+
+	version  Version
+	location *time.Location
+
+	// original contains the groups of the objects in the telegram the packet was parsed from, keyed by OBIS code
+	original map[string][]string
+}
+
+func (e *telegramEncoder) encode(p *P1Packet) {
+	e.header(p.Header)
+
+	if e.version != DSMR22 {
+		// e-MUCS meters send their own version instead of the DSMR version
+		if p.DSMRVersion != "" || p.EMUCSVersion == "" {
+			dsmrVersion := p.DSMRVersion
+			if dsmrVersion == "" {
+				dsmrVersion = map[Version]string{DSMR4: "42", DSMR5: "50"}[e.version]
+			}
+
+			e.line("1-3:0.2.8", dsmrVersion)
+		}
+		if p.EMUCSVersion != "" {
+			e.line("0-0:96.1.4", p.EMUCSVersion)
+		}
+
+		e.line("0-0:1.0.0", e.timestamp(p.Timestamp))
+	}
+
+	e.electricity(&p.Electricity)
+
+	if e.version == DSMR22 {
+		e.line("0-0:96.13.1", plainMessage(p.Message.Code))
+		e.line("0-0:96.13.0", plainMessage(p.Message.Text))
+	} else {
+		e.phaseCounters(p.Electricity.Phases)
+
+		// The message code has been removed in DSMR 5
+		if e.version == DSMR4 || e.has("0-0:96.13.1") || p.Message.Code != "" {
+			e.line("0-0:96.13.1", strings.ToUpper(hex.EncodeToString([]byte(p.Message.Code))))
+		}
+		e.line("0-0:96.13.0", strings.ToUpper(hex.EncodeToString([]byte(p.Message.Text))))
+
+		e.phaseValues(p.Electricity.Phases)
+	}
+
+	for _, device := range mbusDevices(p) {
+		e.mbus(&device)
+	}
+
+	e.unknown(p)
+
+	e.buf.WriteString("!")
+	if e.version != DSMR22 {
+		// The CRC16 is calculated over the telegram up to and including the !
+		fmt.Fprintf(&e.buf, "%04X", crc16(e.buf.Bytes()))
+	}
+	e.buf.WriteString("\r\n")
+}
+
+// plainMessage removes the characters that cannot be sent in a DSMR 2.2 message, which is not hex encoded. Besides the
+// characters that would end the value or line, / and ! are removed, since readers may take them for the start or end
+// of a telegram.
+func plainMessage(message string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '(', ')', '\r', '\n', '/', '!':
+			return -1
+		}
+		return r
+	}, message)
+}
+
+// mbusDevices returns the M-Bus devices of the packet, or its gas meter if it has no M-Bus devices, such as a packet
+// that only sets Gas.
+func mbusDevices(p *P1Packet) []MBusDevice {
+	if len(p.MBus) > 0 || p.Gas == (Gas{}) {
+		return p.MBus
+	}
+
+	device := MBusDevice{
+		Channel:       p.Gas.Channel,
+		DeviceType:    p.Gas.DeviceType,
+		EquipmentID:   p.Gas.EquipmentID,
+		Value:         p.Gas.Consumed,
+		Unit:          "m3",
+		MeasuredAt:    p.Gas.MeasuredAt,
+		ValvePosition: p.Gas.ValvePosition,
+	}
+	if device.Channel == 0 {
+		device.Channel = 1
+	}
+	if device.DeviceType == 0 {
+		device.DeviceType = MBusDeviceTypeGas
+	}
+
+	return []MBusDevice{device}
+}
+
+func (e *telegramEncoder) header(h Header) {
+	if h.ManufacturerID == "" {
+		h = map[Version]Header{
+			DSMR22: {ManufacturerID: "KMP", BaudRate: "5", Identification: "KAMSTRUP"},
+			DSMR4:  {ManufacturerID: "ISk", BaudRate: "5", Identification: "2MT382-1000"},
+			DSMR5:  {ManufacturerID: "Ene", BaudRate: "5", Identification: "T210-D ESMR5.0"},
+		}[e.version]
+	}
+	if h.BaudRate == "" {
+		h.BaudRate = "5"
+	}
+
+	if e.version == DSMR22 {
+		// DSMR 2.2 meters separate the identification with a space and do not send an empty line after the header
+		fmt.Fprintf(&e.buf, "/%s%s %s\r\n", h.ManufacturerID, h.BaudRate, h.Identification)
+		return
+	}
+
+	fmt.Fprintf(&e.buf, "/%s%s\\%s\r\n\r\n", h.ManufacturerID, h.BaudRate, h.Identification)
+}
+
+func (e *telegramEncoder) electricity(el *Electricity) {
+	// DSMR 2.2 has one digit less before the decimal point in its readings
+	readingWidth, powerWidth, powerPrecision := 10, 6, 3
+	if e.version == DSMR22 {
+		readingWidth, powerWidth, powerPrecision = 9, 7, 2
+	}
+
+	e.line(e.code("0-0:96.1.1", "0-0:42.0.0"), el.EquipmentID)
+
+	for _, t := range el.Tariffs {
+		code := fmt.Sprintf("1-0:1.8.%d", t.Number)
+		e.line(code, e.float(code, readingWidth, 3, t.Consumed, "kWh"))
+	}
+	for _, t := range el.Tariffs {
+		code := fmt.Sprintf("1-0:2.8.%d", t.Number)
+		e.line(code, e.float(code, readingWidth, 3, t.Produced, "kWh"))
+	}
+
+	// Only Luxembourg Smarty meters send reactive energy
+	if e.has("1-0:3.8.0") || el.ReactiveConsumed != 0 || el.ReactiveProduced != 0 {
+		e.line("1-0:3.8.0", e.float("1-0:3.8.0", readingWidth, 3, el.ReactiveConsumed, "kvarh"))
+		e.line("1-0:4.8.0", e.float("1-0:4.8.0", readingWidth, 3, el.ReactiveProduced, "kvarh"))
+	}
+
+	e.line("0-0:96.14.0", e.int("0-0:96.14.0", 4, el.Tariff))
+
+	e.line("1-0:1.7.0", e.float("1-0:1.7.0", powerWidth, powerPrecision, el.CurrentConsumed, "kW"))
+	e.line("1-0:2.7.0", e.float("1-0:2.7.0", powerWidth, powerPrecision, el.CurrentProduced, "kW"))
+
+	if e.has("1-0:3.7.0") || el.CurrentReactiveConsumed != 0 || el.CurrentReactiveProduced != 0 {
+		e.line("1-0:3.7.0", e.float("1-0:3.7.0", powerWidth, powerPrecision, el.CurrentReactiveConsumed, "kvar"))
+		e.line("1-0:4.7.0", e.float("1-0:4.7.0", powerWidth, powerPrecision, el.CurrentReactiveProduced, "kvar"))
+	}
+
+	if el.ThresholdUnit != "" {
+		width, precision := 5, 1
+		if el.ThresholdUnit == "A" {
+			width, precision = 3, 0
+		}
+		e.line("0-0:17.0.0", e.float("0-0:17.0.0", width, precision, el.Threshold, el.ThresholdUnit))
+	}
+
+	// The switch position has been removed in DSMR 5, but e-MUCS meters still send it
+	if e.version != DSMR5 || e.has("0-0:96.3.10") {
+		e.line("0-0:96.3.10", e.int("0-0:96.3.10", 1, el.SwitchPosition))
+	}
+
+	if e.version == DSMR22 {
+		return
+	}
+
+	e.line("0-0:96.7.21", e.int("0-0:96.7.21", 5, el.NumberOfPowerFailures))
+	e.line("0-0:96.7.9", e.int("0-0:96.7.9", 5, el.NumberOfLongPowerFailures))
+
+	events := []string{fmt.Sprint(len(el.PowerFailureEventLog)), "0-0:96.7.19"}
+	for _, item := range el.PowerFailureEventLog {
+		events = append(events, e.timestamp(item.Timestamp), e.int("1-0:99.97.0", 10, int(item.Duration/time.Second))+"*s")
+	}
+	e.line("1-0:99.97.0", events...)
+
+	if c := el.CapacityTariff; c != nil {
+		e.line("1-0:1.4.0", e.float("1-0:1.4.0", 6, 3, c.CurrentAverageDemand, "kW"))
+		e.line("1-0:1.6.0", e.timestamp(c.MaximumDemand.Timestamp), e.float("1-0:1.6.0", 6, 3, c.MaximumDemand.Value, "kW"))
+
+		history := []string{fmt.Sprint(len(c.MaximumDemandHistory)), "1-0:1.6.0", "1-0:1.6.0"}
+		for _, item := range c.MaximumDemandHistory {
+			history = append(history, e.timestamp(item.Month), e.timestamp(item.Timestamp), e.float("0-0:98.1.0", 6, 3, item.Value, "kW"))
+		}
+		e.line("0-0:98.1.0", history...)
+	}
+}
+
+func (e *telegramEncoder) phaseCounters(phases []Phase) {
+	for _, phase := range phases {
+		code := phaseCode(phase, 32, "32.0")
+		e.line(code, e.int(code, 5, phase.NumberOfVoltageSags))
+	}
+	for _, phase := range phases {
+		code := phaseCode(phase, 32, "36.0")
+		e.line(code, e.int(code, 5, phase.NumberOfVoltageSwells))
+	}
+}
+
+func (e *telegramEncoder) phaseValues(phases []Phase) {
+	for _, phase := range phases {
+		code := phaseCode(phase, 32, "7.0")
+		e.line(code, e.float(code, 5, 1, phase.InstantaneousVoltage, "V"))
+	}
+	for _, phase := range phases {
+		code := phaseCode(phase, 31, "7.0")
+		e.line(code, e.float(code, 3, 0, phase.InstantaneousCurrent, "A"))
+	}
+	for _, phase := range phases {
+		code := phaseCode(phase, 21, "7.0")
+		e.line(code, e.float(code, 6, 3, phase.InstantaneousActivePositivePower, "kW"))
+	}
+	for _, phase := range phases {
+		code := phaseCode(phase, 22, "7.0")
+		e.line(code, e.float(code, 6, 3, phase.InstantaneousActiveNegativePower, "kW"))
+	}
+}
+
+// phaseCode returns the code of an object of the phase, where quantity is the second group of the code for L1, which
+// is 20 higher for every next phase.
+func phaseCode(phase Phase, quantity int, rest string) string {
+	return fmt.Sprintf("1-0:%d.%s", quantity+(phase.Number-1)*20, rest)
+}
+
+func (e *telegramEncoder) mbus(d *MBusDevice) {
+	deviceType := fmt.Sprintf("0-%d:24.1.0", d.Channel)
+	// e-MUCS meters send the equipment ID in 0-n:96.1.1 and the uncorrected reading in 0-n:24.2.3
+	equipmentID := e.code(fmt.Sprintf("0-%d:96.1.0", d.Channel), fmt.Sprintf("0-%d:96.1.1", d.Channel))
+	reading := e.code(fmt.Sprintf("0-%d:24.2.1", d.Channel), fmt.Sprintf("0-%d:24.2.3", d.Channel))
+	valvePosition := fmt.Sprintf("0-%d:24.4.0", d.Channel)
+
+	switch e.version {
+	case DSMR22:
+		e.line(deviceType, e.int(deviceType, 1, d.DeviceType))
+		e.line(equipmentID, d.EquipmentID)
+		// The reading is on the next line
+		dsmr22Reading := fmt.Sprintf("0-%d:24.3.0", d.Channel)
+		e.line(dsmr22Reading, e.timestamp(d.MeasuredAt), "08", "60", "1", reading, d.Unit)
+		e.line("", e.float(dsmr22Reading, 9, 3, d.Value, ""))
+		e.line(valvePosition, e.int(valvePosition, 1, d.ValvePosition))
+	case DSMR4:
+		e.line(deviceType, e.int(deviceType, 2, d.DeviceType))
+		e.line(equipmentID, d.EquipmentID)
+		e.line(reading, e.timestamp(d.MeasuredAt), e.float(reading, 9, 3, d.Value, d.Unit))
+		e.line(valvePosition, e.int(valvePosition, 1, d.ValvePosition))
+	default:
+		e.line(deviceType, e.int(deviceType, 3, d.DeviceType))
+		e.line(equipmentID, d.EquipmentID)
+		e.line(reading, e.timestamp(d.MeasuredAt), e.float(reading, 9, 3, d.Value, d.Unit))
+		// The valve position has been removed in DSMR 5, but e-MUCS meters still send it
+		if e.has(valvePosition) {
+			e.line(valvePosition, e.int(valvePosition, 1, d.ValvePosition))
+		}
+	}
+}
+
+// has returns whether the telegram the packet was parsed from contains the object.
+func (e *telegramEncoder) has(code string) bool {
+	_, ok := e.original[code]
+	return ok
+}
+
+// code returns the first alternative code of an object that the telegram the packet was parsed from contains, or code
+// if it contains none of them.
+func (e *telegramEncoder) code(code string, alternatives ...string) string {
+	for _, alternative := range alternatives {
+		if e.has(alternative) {
+			return alternative
+		}
+	}
+	return code
+}
+
+// originalValue returns the last group of the object in the telegram the packet was parsed from without its unit.
+func (e *telegramEncoder) originalValue(code string) (string, bool) {
+	groups := e.original[code]
+	if len(groups) == 0 {
+		return "", false
+	}
+
+	value, _ := splitValueAndUnit(groups[len(groups)-1])
+	return value, true
+}
+
+// float formats a value with the width and precision it had in the telegram the packet was parsed from, or with the
+// given width and precision otherwise, followed by the unit if it is not empty.
+func (e *telegramEncoder) float(code string, width, precision int, value float64, unit string) string {
+	if original, ok := e.originalValue(code); ok {
+		if _, err := strconv.ParseFloat(original, 64); err == nil {
+			width, precision = len(original), 0
+			if i := strings.IndexByte(original, '.'); i >= 0 {
+				precision = len(original) - i - 1
+			}
+		}
+	}
+
+	result := fmt.Sprintf("%0*.*f", width, precision, value)
+	if unit != "" {
+		result += "*" + unit
+	}
+	return result
+}
+
+// int formats a value with the width it had in the telegram the packet was parsed from, or with the given width
+// otherwise.
+func (e *telegramEncoder) int(code string, width int, value int) string {
+	if original, ok := e.originalValue(code); ok {
+		if _, err := strconv.Atoi(original); err == nil {
+			width = len(original)
+		}
+	}
+
+	return fmt.Sprintf("%0*d", width, value)
+}
+
+// unknown writes the objects that are not written by the encoder itself, sorted by their code.
+func (e *telegramEncoder) unknown(p *P1Packet) {
+	var codes []string
+	for code := range p.Unknown {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		e.buf.WriteString(code + p.Unknown[code] + "\r\n")
+	}
+
+	codes = codes[:0]
+	for code := range p.Extra {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		e.line(code, p.Extra[code].Groups...)
+	}
+}
+
+func (e *telegramEncoder) line(code string, groups ...string) {
+	e.buf.WriteString(code)
+	for _, group := range groups {
+		e.buf.WriteString("(" + group + ")")
+	}
+	e.buf.WriteString("\r\n")
+}
+
+// timestamp formats a timestamp in YYMMDDhhmmssX format, where X is S or W for summer or winter time. DSMR 2.2 does not
+// use the S or W.
+func (e *telegramEncoder) timestamp(t time.Time) string {
+	if e.version == DSMR22 {
+		return t.In(e.location).Format(dateFormat)
+	}
+
+	if t.IsZero() {
+		return unsetTimestamp + "W"
+	}
+
+	t = t.In(e.location)
+
+	if t.IsDST() {
+		return t.Format(dateFormat) + "S"
+	}
+	return t.Format(dateFormat) + "W"
+}
@@ -3,13 +3,28 @@ package smartmeter
 import "fmt"
 
 type ParseError struct {
+	// Line is the 1-based line number in the telegram, or 0 if it is unknown
+	Line int
+	// Code is the OBIS code of the line, or empty if it is unknown
+	Code string
+
 	Value string
 	Type  string
 	Err   error
 }
 
 func (e *ParseError) Error() string {
-	return fmt.Sprintf("failed to parse %v as %s: %v", e.Value, e.Type, e.Err)
+	if e.Line == 0 {
+		return fmt.Sprintf("failed to parse %v as %s: %v", e.Value, e.Type, e.Err)
+	}
+	if e.Code == "" {
+		return fmt.Sprintf("line %d: failed to parse %v as %s: %v", e.Line, e.Value, e.Type, e.Err)
+	}
+	return fmt.Sprintf("line %d (%s): failed to parse %v as %s: %v", e.Line, e.Code, e.Value, e.Type, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
 }
 
 func WrapError(err error, t, value string) error {
@@ -19,3 +34,16 @@ func WrapError(err error, t, value string) error {
 		Err:   err,
 	}
 }
+
+// ChecksumError is returned when the CRC16 sent at the end of a telegram does not match the CRC16 calculated over the
+// received telegram, which usually means the telegram was corrupted during transmission.
+type ChecksumError struct {
+	// Expected is the checksum that was sent after the ! of the telegram
+	Expected uint16
+	// Actual is the checksum calculated over the received telegram
+	Actual uint16
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("invalid telegram checksum: expected %04X, calculated %04X", e.Expected, e.Actual)
+}
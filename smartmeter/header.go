@@ -0,0 +1,53 @@
+package smartmeter
+
+import (
+	"strings"
+)
+
+// Header is the identification line at the start of a telegram, such as /ISk5\2MT382-1000, which has the format
+// /XXXZIdentification as defined by IEC 62056-21.
+type Header struct {
+	// ManufacturerID is the three letter FLAG manufacturer ID as sent by the meter, such as ISk
+	ManufacturerID string
+	// BaudRate is the baud rate identification character, which is 5 for all DSMR meters
+	BaudRate string
+	// Identification is the identification of the meter, usually its model, without the leading backslash
+	Identification string
+}
+
+// manufacturers contains the names of the manufacturers of common meters, keyed by their upper case FLAG ID.
+var manufacturers = map[string]string{
+	"ELS": "Elster",
+	"EMH": "EMH metering",
+	"ENE": "Sagemcom",
+	"FLU": "Fluvius",
+	"ISK": "Iskraemeco",
+	"KFM": "Kaifa",
+	"KMP": "Kamstrup",
+	"LGF": "Landis+Gyr",
+	"LGZ": "Landis+Gyr",
+	"SAG": "Sagemcom",
+	"XMX": "Xemex",
+}
+
+// Manufacturer returns the name of the manufacturer of the meter, or the manufacturer ID if it is unknown.
+func (h Header) Manufacturer() string {
+	if name, ok := manufacturers[strings.ToUpper(h.ManufacturerID)]; ok {
+		return name
+	}
+	return h.ManufacturerID
+}
+
+// parseHeader parses the identification line of a telegram. Lines that do not look like a header result in an empty
+// header.
+func parseHeader(line string) Header {
+	if len(line) < 5 || line[0] != '/' {
+		return Header{}
+	}
+
+	return Header{
+		ManufacturerID: line[1:4],
+		BaudRate:       line[4:5],
+		Identification: strings.TrimPrefix(strings.TrimSpace(line[5:]), `\`),
+	}
+}
@@ -0,0 +1,88 @@
+package smartmeter
+
+import (
+	"sort"
+	"time"
+)
+
+// MBusChannels is the number of M-Bus channels a meter can have (0-1: up to 0-4:).
+const MBusChannels = 4
+
+// Device types of M-Bus devices as defined in EN 13757-3, as found in 0-n:24.1.0.
+const (
+	MBusDeviceTypeGas        = 3
+	MBusDeviceTypeHeatOutlet = 4
+	MBusDeviceTypeWarmWater  = 6
+	MBusDeviceTypeWater      = 7
+	MBusDeviceTypeHeatInlet  = 12
+)
+
+type MBusDevice struct {
+	// Channel is the M-Bus channel the device is connected to, from 1 up to MBusChannels
+	Channel int
+	// DeviceType is the device type, see the MBusDeviceType constants (0-n:24.1.0)
+	DeviceType int
+	// EquipmentID is the equipment identifier (0-n:96.1.0)
+	EquipmentID string
+	// Value is the last reading of the device in the unit of Unit (0-n:24.2.1)
+	Value float64
+	// Unit is the unit of Value, usually m3 for gas and water and GJ for heat
+	Unit string
+	// MeasuredAt is the time at which the reading was taken (0-n:24.2.1)
+	MeasuredAt time.Time
+	// ValvePosition is the position of the valve (on/off/released) (0-n:24.4.0)
+	ValvePosition int
+}
+
+// Kind returns a short lowercase name of the device type, such as gas, water or heat, which is suitable for use in
+// labels and tags. Unknown device types return unknown.
+func (d *MBusDevice) Kind() string {
+	switch d.DeviceType {
+	case MBusDeviceTypeGas:
+		return "gas"
+	case MBusDeviceTypeWater:
+		return "water"
+	case MBusDeviceTypeWarmWater:
+		return "warm_water"
+	case MBusDeviceTypeHeatOutlet, MBusDeviceTypeHeatInlet:
+		return "heat"
+	}
+	return "unknown"
+}
+
+// mbusDevice returns the device on the channel, adding it to the packet if it does not exist yet.
+func (p *P1Packet) mbusDevice(channel int) *MBusDevice {
+	for i := range p.MBus {
+		if p.MBus[i].Channel == channel {
+			return &p.MBus[i]
+		}
+	}
+
+	p.MBus = append(p.MBus, MBusDevice{
+		Channel: channel,
+	})
+	sort.Slice(p.MBus, func(i, j int) bool {
+		return p.MBus[i].Channel < p.MBus[j].Channel
+	})
+
+	return p.mbusDevice(channel)
+}
+
+// gasFromMBus returns the first gas meter in the M-Bus devices. Since DSMR 2.2 always connects the gas meter to the
+// first channel, a device on channel 1 without device type is also considered to be a gas meter.
+func gasFromMBus(devices []MBusDevice) Gas {
+	for _, device := range devices {
+		if device.DeviceType == MBusDeviceTypeGas || (device.Channel == 1 && device.DeviceType == 0) {
+			return Gas{
+				Channel:       device.Channel,
+				EquipmentID:   device.EquipmentID,
+				DeviceType:    device.DeviceType,
+				Consumed:      device.Value,
+				MeasuredAt:    device.MeasuredAt,
+				ValvePosition: device.ValvePosition,
+			}
+		}
+	}
+
+	return Gas{}
+}
@@ -0,0 +1,43 @@
+package smartmeter
+
+import (
+	"fmt"
+)
+
+// Mode determines how lines of a telegram that cannot be parsed are handled.
+type Mode int
+
+const (
+	// StrictMode fails to parse the whole telegram when a line has an invalid format or unit.
+	StrictMode Mode = iota
+	// LenientMode skips lines that cannot be parsed and adds a warning for them to P1Packet.Warnings.
+	LenientMode
+)
+
+func (m Mode) String() string {
+	switch m {
+	case StrictMode:
+		return "strict"
+	case LenientMode:
+		return "lenient"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// Set implements pflag.Value.
+func (m *Mode) Set(value string) error {
+	switch value {
+	case "strict":
+		*m = StrictMode
+	case "lenient":
+		*m = LenientMode
+	default:
+		return fmt.Errorf("invalid mode %q, must be strict or lenient", value)
+	}
+	return nil
+}
+
+// Type implements pflag.Value.
+func (m *Mode) Type() string {
+	return "mode"
+}
@@ -0,0 +1,237 @@
+package smartmeter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ValueType is the type of the value of an OBIS object.
+type ValueType int
+
+const (
+	// StringValue is a value that is used as-is, such as an equipment identifier.
+	StringValue ValueType = iota
+	// IntValue is an integer value, such as a counter.
+	IntValue
+	// FloatValue is a decimal value, such as a meter reading.
+	FloatValue
+	// TimestampValue is a timestamp in YYMMDDhhmmssX format.
+	TimestampValue
+	// BufferValue is a value consisting of multiple groups that is interpreted by the Apply function itself, such as
+	// the power failure event log.
+	BufferValue
+)
+
+// Value is a single OBIS object as it was found in a telegram.
+type Value struct {
+	// Code is the OBIS reduced ID code of the object, such as 1-0:1.8.1
+	Code string
+	// Groups contains the raw contents of all parenthesised groups following the code
+	Groups []string
+	// Unit is the unit of the last group, or empty if it does not have a unit
+	Unit string
+
+	// String is the last group without its unit
+	String string
+	// Int is the value of the last group if the type is IntValue
+	Int int
+	// Float is the value of the last group if the type is FloatValue
+	Float float64
+	// Timestamp is the value of the last group if the type is TimestampValue. For Timestamped objects, it is the value
+	// of the first group if there is more than one group, such as the time at which a gas reading was taken.
+	Timestamp time.Time
+
+	location *time.Location
+}
+
+// ParseTimestamp parses a timestamp in YYMMDDhhmmssX format in the timezone of the telegram, which can be used by
+// Apply functions to parse the timestamps in the groups of a BufferValue.
+func (v *Value) ParseTimestamp(data string) (time.Time, error) {
+	return parseTimestamp(data, v.location)
+}
+
+// OBISObject describes how an OBIS object in a telegram should be parsed and stored in a P1Packet.
+type OBISObject struct {
+	// Name is a human-readable name of the object, used in errors
+	Name string
+	// Units contains the units the value may have. If it is empty, the unit is not checked.
+	Units []string
+	// Type is the type of the value
+	Type ValueType
+	// Timestamped is set if the first of multiple groups is the time at which the value was measured, such as for
+	// M-Bus readings. Otherwise, the groups before the last group are only available in Value.Groups.
+	Timestamped bool
+	// Apply stores the parsed value in the packet. If it is nil, the value is stored in P1Packet.Extra.
+	Apply func(p *P1Packet, v *Value) error
+}
+
+// Registry contains the OBIS objects that are recognised in telegrams, keyed by their OBIS reduced ID code. It is safe
+// for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	objects map[string]OBISObject
+}
+
+// DefaultRegistry is the registry used by SmartMeter unless it is created with NewWithRegistry.
+var DefaultRegistry = NewDefaultRegistry()
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		objects: make(map[string]OBISObject),
+	}
+}
+
+// NewDefaultRegistry creates a registry that contains all objects defined by DSMR 2.2 up to 5.0, e-MUCS and Smarty,
+// which can be extended without affecting the DefaultRegistry.
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	registerDefaultObjects(r)
+	return r
+}
+
+// Register adds or replaces the object for an OBIS code.
+func (r *Registry) Register(code string, object OBISObject) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.objects[code] = object
+}
+
+// Lookup returns the object for an OBIS code.
+func (r *Registry) Lookup(code string) (OBISObject, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	object, ok := r.objects[code]
+	return object, ok
+}
+
+// Register adds or replaces the object for an OBIS code in the DefaultRegistry.
+func Register(code string, object OBISObject) {
+	DefaultRegistry.Register(code, object)
+}
+
+func parseValue(code string, groups []string, object OBISObject, location *time.Location) (*Value, error) {
+	v := &Value{
+		Code:     code,
+		Groups:   groups,
+		location: location,
+	}
+
+	if len(groups) == 0 {
+		return v, nil
+	}
+
+	last := groups[len(groups)-1]
+	if object.Type == BufferValue {
+		v.String = last
+		return v, nil
+	}
+
+	v.String, v.Unit = splitValueAndUnit(last)
+
+	if len(object.Units) > 0 && !containsUnit(object.Units, v.Unit) {
+		return nil, WrapError(fmt.Errorf("invalid unit %q", v.Unit), object.Name, last)
+	}
+
+	var err error
+
+	switch object.Type {
+	case IntValue:
+		v.Int, err = strconv.Atoi(v.String)
+	case FloatValue:
+		v.Float, err = strconv.ParseFloat(v.String, 64)
+	case TimestampValue:
+		v.Timestamp, err = v.ParseTimestamp(v.String)
+	}
+	if err != nil {
+		return nil, WrapError(err, object.Name, v.String)
+	}
+
+	if object.Timestamped && object.Type != TimestampValue && len(groups) > 1 {
+		v.Timestamp, err = v.ParseTimestamp(groups[0])
+		if err != nil {
+			return nil, WrapError(err, object.Name+" timestamp", groups[0])
+		}
+	}
+
+	return v, nil
+}
+
+// parseTimestamp parses a timestamp in YYMMDDhhmmssX format in the location, where X is an optional S or W for summer
+// or winter time. The S or W is used to resolve the hour that occurs twice when the clock is set back at the end of
+// summer time. The placeholder 632525252525 that e-MUCS meters send for timestamps that have not been set yet results
+// in a zero time.
+func parseTimestamp(data string, location *time.Location) (time.Time, error) {
+	var dst byte
+	if len(data) == len(dateFormat)+1 {
+		dst = data[len(data)-1]
+		data = data[:len(data)-1]
+	}
+
+	if data == unsetTimestamp {
+		return time.Time{}, nil
+	}
+
+	t, err := time.ParseInLocation(dateFormat, data, location)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if (dst == 'S' && !t.IsDST()) || (dst == 'W' && t.IsDST()) {
+		// The same wall clock time exists an hour earlier or later with the other offset
+		for _, d := range []time.Duration{-time.Hour, time.Hour} {
+			if alt := t.Add(d); alt.IsDST() != t.IsDST() && alt.Format(dateFormat) == data {
+				return alt, nil
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// splitLine splits a line of a telegram into its OBIS code and the contents of its parenthesised groups. Spaces in the
+// OBIS code are removed, since OBIS codes never contain them, but the example telegram of DSMR 4.0 does.
+func splitLine(line string) (string, []string, bool) {
+	dataStart := strings.IndexByte(line, '(')
+	if dataStart < 0 {
+		return "", nil, false
+	}
+
+	code := strings.ReplaceAll(line[:dataStart], " ", "")
+
+	var groups []string
+	for rest := line[dataStart:]; len(rest) > 0 && rest[0] == '('; {
+		dataEnd := strings.IndexByte(rest, ')')
+		if dataEnd < 0 {
+			return "", nil, false
+		}
+
+		groups = append(groups, rest[1:dataEnd])
+		rest = rest[dataEnd+1:]
+	}
+
+	return code, groups, true
+}
+
+func splitValueAndUnit(data string) (string, string) {
+	index := strings.LastIndex(data, "*")
+	if index < 0 {
+		return data, ""
+	}
+
+	return data[:index], data[index+1:]
+}
+
+func containsUnit(units []string, unit string) bool {
+	for _, u := range units {
+		if u == unit {
+			return true
+		}
+	}
+	return false
+}
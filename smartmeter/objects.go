@@ -0,0 +1,327 @@
+package smartmeter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxTariffs is the number of tariff registers that are recognised (1-0:1.8.1 up to 1-0:1.8.9), besides the total of
+// all tariffs (1-0:1.8.0).
+const MaxTariffs = 9
+
+// MaxPhases is the number of phases that are recognised (L1 up to L3).
+const MaxPhases = 3
+
+func registerDefaultObjects(r *Registry) {
+	r.Register("1-3:0.2.8", stringObject("DSMR version", func(p *P1Packet) *string { return &p.DSMRVersion }))
+	r.Register("0-0:96.1.4", stringObject("e-MUCS version", func(p *P1Packet) *string { return &p.EMUCSVersion }))
+	r.Register("0-0:1.0.0", OBISObject{
+		Name: "timestamp",
+		Type: TimestampValue,
+		Apply: func(p *P1Packet, v *Value) error {
+			p.Timestamp = v.Timestamp
+			return nil
+		},
+	})
+
+	r.Register("0-0:96.1.1", stringObject("electricity equipment ID", func(p *P1Packet) *string { return &p.Electricity.EquipmentID }))
+	// Luxembourg Smarty meters send their logical device name instead of an equipment ID
+	r.Register("0-0:42.0.0", stringObject("electricity equipment ID", func(p *P1Packet) *string { return &p.Electricity.EquipmentID }))
+	r.Register("0-0:96.14.0", intObject("tariff", func(p *P1Packet) *int { return &p.Electricity.Tariff }))
+	r.Register("0-0:96.3.10", intObject("switch position", func(p *P1Packet) *int { return &p.Electricity.SwitchPosition }))
+	r.Register("0-0:17.0.0", OBISObject{
+		Name:  "threshold",
+		Units: []string{"A", "kW", "kVA"},
+		Type:  FloatValue,
+		Apply: func(p *P1Packet, v *Value) error {
+			p.Electricity.Threshold = v.Float
+			p.Electricity.ThresholdUnit = v.Unit
+			return nil
+		},
+	})
+
+	// Tariff 0 is the total of all tariffs, which Luxembourg Smarty meters send instead of separate tariffs
+	for tariff := 0; tariff <= MaxTariffs; tariff++ {
+		r.Register(fmt.Sprintf("1-0:1.8.%d", tariff), floatObject("electricity delivery", "kWh", func(p *P1Packet) *float64 { return &p.Electricity.tariff(tariff).Consumed }))
+		r.Register(fmt.Sprintf("1-0:2.8.%d", tariff), floatObject("electricity delivery", "kWh", func(p *P1Packet) *float64 { return &p.Electricity.tariff(tariff).Produced }))
+	}
+
+	r.Register("1-0:1.7.0", floatObject("electricity usage", "kW", func(p *P1Packet) *float64 { return &p.Electricity.CurrentConsumed }))
+	r.Register("1-0:2.7.0", floatObject("electricity usage", "kW", func(p *P1Packet) *float64 { return &p.Electricity.CurrentProduced }))
+
+	r.Register("1-0:3.8.0", floatObject("reactive energy", "kvarh", func(p *P1Packet) *float64 { return &p.Electricity.ReactiveConsumed }))
+	r.Register("1-0:4.8.0", floatObject("reactive energy", "kvarh", func(p *P1Packet) *float64 { return &p.Electricity.ReactiveProduced }))
+	r.Register("1-0:3.7.0", floatObject("reactive power", "kvar", func(p *P1Packet) *float64 { return &p.Electricity.CurrentReactiveConsumed }))
+	r.Register("1-0:4.7.0", floatObject("reactive power", "kvar", func(p *P1Packet) *float64 { return &p.Electricity.CurrentReactiveProduced }))
+
+	r.Register("0-0:96.7.21", intObject("number of power failures", func(p *P1Packet) *int { return &p.Electricity.NumberOfPowerFailures }))
+	r.Register("0-0:96.7.9", intObject("number of long power failures", func(p *P1Packet) *int { return &p.Electricity.NumberOfLongPowerFailures }))
+	r.Register("1-0:99.97.0", OBISObject{
+		Name:  "power failure event log",
+		Type:  BufferValue,
+		Apply: applyPowerFailureEventLog,
+	})
+
+	r.Register("1-0:1.4.0", floatObject("current average demand", "kW", func(p *P1Packet) *float64 { return &p.Electricity.capacityTariff().CurrentAverageDemand }))
+	r.Register("1-0:1.6.0", OBISObject{
+		Name:        "maximum demand",
+		Units:       []string{"kW"},
+		Type:        FloatValue,
+		Timestamped: true,
+		Apply: func(p *P1Packet, v *Value) error {
+			p.Electricity.capacityTariff().MaximumDemand = Demand{
+				Timestamp: v.Timestamp,
+				Value:     v.Float,
+			}
+			return nil
+		},
+	})
+	r.Register("0-0:98.1.0", OBISObject{
+		Name:  "maximum demand history",
+		Type:  BufferValue,
+		Apply: applyMaximumDemandHistory,
+	})
+
+	// The codes of the phases L1, L2 and L3 differ by 20 in their second group, for example 1-0:32.7.0 for L1, 1-0:52.7.0
+	// for L2 and 1-0:72.7.0 for L3.
+	for number := 1; number <= MaxPhases; number++ {
+		phase := fmt.Sprintf("in phase L%d", number)
+		offset := (number - 1) * 20
+
+		r.Register(fmt.Sprintf("1-0:%d.32.0", 32+offset), intObject("number of power voltage sags "+phase, func(p *P1Packet) *int { return &p.Electricity.phase(number).NumberOfVoltageSags }))
+		r.Register(fmt.Sprintf("1-0:%d.36.0", 32+offset), intObject("number of power voltage swells "+phase, func(p *P1Packet) *int { return &p.Electricity.phase(number).NumberOfVoltageSwells }))
+		r.Register(fmt.Sprintf("1-0:%d.7.0", 32+offset), floatObject("instantaneous voltage "+phase, "V", func(p *P1Packet) *float64 { return &p.Electricity.phase(number).InstantaneousVoltage }))
+		r.Register(fmt.Sprintf("1-0:%d.7.0", 31+offset), floatObject("instantaneous current "+phase, "A", func(p *P1Packet) *float64 { return &p.Electricity.phase(number).InstantaneousCurrent }))
+		r.Register(fmt.Sprintf("1-0:%d.7.0", 21+offset), floatObject("instantaneous active power P+ "+phase, "kW", func(p *P1Packet) *float64 { return &p.Electricity.phase(number).InstantaneousActivePositivePower }))
+		r.Register(fmt.Sprintf("1-0:%d.7.0", 22+offset), floatObject("instantaneous active power P- "+phase, "kW", func(p *P1Packet) *float64 { return &p.Electricity.phase(number).InstantaneousActiveNegativePower }))
+	}
+
+	for channel := 1; channel <= MBusChannels; channel++ {
+		device := func(p *P1Packet) *MBusDevice { return p.mbusDevice(channel) }
+
+		r.Register(fmt.Sprintf("0-%d:24.1.0", channel), intObject("device type", func(p *P1Packet) *int { return &device(p).DeviceType }))
+		r.Register(fmt.Sprintf("0-%d:96.1.0", channel), stringObject("M-Bus equipment ID", func(p *P1Packet) *string { return &device(p).EquipmentID }))
+		// e-MUCS meters send the equipment ID in 0-n:96.1.1 instead
+		r.Register(fmt.Sprintf("0-%d:96.1.1", channel), stringObject("M-Bus equipment ID", func(p *P1Packet) *string { return &device(p).EquipmentID }))
+		r.Register(fmt.Sprintf("0-%d:24.4.0", channel), intObject("valve position", func(p *P1Packet) *int { return &device(p).ValvePosition }))
+
+		reading := OBISObject{
+			Name:        "M-Bus reading",
+			Units:       []string{"m3", "GJ", "kWh", "MWh"},
+			Type:        FloatValue,
+			Timestamped: true,
+			Apply: func(p *P1Packet, v *Value) error {
+				d := device(p)
+				d.Value = v.Float
+				d.Unit = v.Unit
+				d.MeasuredAt = v.Timestamp
+				return nil
+			},
+		}
+		// 0-n:24.2.1 is the temperature corrected reading, 0-n:24.2.3 the uncorrected reading used by e-MUCS meters
+		r.Register(fmt.Sprintf("0-%d:24.2.1", channel), reading)
+		r.Register(fmt.Sprintf("0-%d:24.2.3", channel), reading)
+
+		r.Register(fmt.Sprintf("0-%d:24.3.0", channel), OBISObject{
+			Name: "M-Bus reading",
+			Type: BufferValue,
+			Apply: func(p *P1Packet, v *Value) error {
+				return applyDSMR22MBusReading(device(p), v)
+			},
+		})
+	}
+
+	r.Register("0-0:96.13.1", messageObject("text message code", func(p *P1Packet) *string { return &p.Message.Code }))
+	r.Register("0-0:96.13.0", messageObject("text message", func(p *P1Packet) *string { return &p.Message.Text }))
+}
+
+func stringObject(name string, field func(p *P1Packet) *string) OBISObject {
+	return OBISObject{
+		Name: name,
+		Type: StringValue,
+		Apply: func(p *P1Packet, v *Value) error {
+			*field(p) = v.String
+			return nil
+		},
+	}
+}
+
+func intObject(name string, field func(p *P1Packet) *int) OBISObject {
+	return OBISObject{
+		Name: name,
+		Type: IntValue,
+		Apply: func(p *P1Packet, v *Value) error {
+			*field(p) = v.Int
+			return nil
+		},
+	}
+}
+
+func floatObject(name, unit string, field func(p *P1Packet) *float64) OBISObject {
+	return OBISObject{
+		Name:  name,
+		Units: []string{unit},
+		Type:  FloatValue,
+		Apply: func(p *P1Packet, v *Value) error {
+			*field(p) = v.Float
+			return nil
+		},
+	}
+}
+
+// messageObject is an object containing text that DSMR 4 and up send as a hex encoded octet string. DSMR 2.2 and 3 send
+// the text as-is, such as the 8 digit numeric message code, so the text is only decoded if the telegram has declared
+// its DSMR version (1-3:0.2.8), which is only sent since DSMR 4, or its e-MUCS version (0-0:96.1.4). Both precede the
+// messages.
+func messageObject(name string, field func(p *P1Packet) *string) OBISObject {
+	return OBISObject{
+		Name: name,
+		Type: StringValue,
+		Apply: func(p *P1Packet, v *Value) error {
+			if p.DSMRVersion == "" && p.EMUCSVersion == "" {
+				*field(p) = v.String
+				return nil
+			}
+
+			*field(p) = decodeMessage(v.String)
+			return nil
+		},
+	}
+}
+
+// decodeMessage decodes a hex encoded message. Messages that are not valid UTF-8 are decoded as ISO 8859-1, which is
+// what older meters use for non-ASCII characters.
+func decodeMessage(data string) string {
+	decoded, err := hex.DecodeString(data)
+	if err != nil {
+		return data
+	}
+
+	decoded = bytes.TrimRight(decoded, "\x00")
+
+	if utf8.Valid(decoded) {
+		return string(decoded)
+	}
+
+	runes := make([]rune, len(decoded))
+	for i, b := range decoded {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// applyPowerFailureEventLog parses the power failure event log, which has the format
+// 1-0:99.97.0(count)(0-0:96.7.19)(timestamp)(duration*s)(timestamp)(duration*s)...
+func applyPowerFailureEventLog(p *P1Packet, v *Value) error {
+	numberOfPowerFailures, err := strconv.Atoi(v.Groups[0])
+	if err != nil {
+		return WrapError(err, "number of power failures", v.Groups[0])
+	}
+
+	if numberOfPowerFailures == 0 {
+		return nil
+	}
+
+	if len(v.Groups) < 2 || v.Groups[1] != "0-0:96.7.19" {
+		return WrapError(fmt.Errorf("invalid data format"), "power failure event log", fmt.Sprint(v.Groups))
+	}
+
+	for i := 2; i+1 < len(v.Groups) && len(p.Electricity.PowerFailureEventLog) < numberOfPowerFailures; i += 2 {
+		item := PowerFailure{}
+
+		item.Timestamp, err = v.ParseTimestamp(v.Groups[i])
+		if err != nil {
+			return WrapError(err, "power failure timestamp", v.Groups[i])
+		}
+
+		data, unit := splitValueAndUnit(v.Groups[i+1])
+		if unit != "s" {
+			return WrapError(fmt.Errorf("invalid unit %q", unit), "power failure duration", v.Groups[i+1])
+		}
+
+		duration, err := strconv.Atoi(data)
+		if err != nil {
+			return WrapError(err, "power failure duration", data)
+		}
+
+		item.Duration = time.Duration(duration) * time.Second
+
+		p.Electricity.PowerFailureEventLog = append(p.Electricity.PowerFailureEventLog, item)
+	}
+
+	return nil
+}
+
+// applyMaximumDemandHistory parses the maximum demand history of the last 13 months, which has the format
+// 0-0:98.1.0(count)(1-0:1.6.0)(1-0:1.6.0)(month)(timestamp)(demand*kW)(month)(timestamp)(demand*kW)...
+func applyMaximumDemandHistory(p *P1Packet, v *Value) error {
+	count, err := strconv.Atoi(v.Groups[0])
+	if err != nil {
+		return WrapError(err, "number of months in maximum demand history", v.Groups[0])
+	}
+
+	c := p.Electricity.capacityTariff()
+
+	if count == 0 {
+		return nil
+	}
+
+	if len(v.Groups) < 3 || v.Groups[1] != "1-0:1.6.0" || v.Groups[2] != "1-0:1.6.0" {
+		return WrapError(fmt.Errorf("invalid data format"), "maximum demand history", fmt.Sprint(v.Groups))
+	}
+
+	for i := 3; i+2 < len(v.Groups) && len(c.MaximumDemandHistory) < count; i += 3 {
+		item := MonthlyDemand{}
+
+		item.Month, err = v.ParseTimestamp(v.Groups[i])
+		if err != nil {
+			return WrapError(err, "maximum demand month", v.Groups[i])
+		}
+
+		item.Timestamp, err = v.ParseTimestamp(v.Groups[i+1])
+		if err != nil {
+			return WrapError(err, "maximum demand timestamp", v.Groups[i+1])
+		}
+
+		data, unit := splitValueAndUnit(v.Groups[i+2])
+		if unit != "kW" {
+			return WrapError(fmt.Errorf("invalid unit %q", unit), "maximum demand", v.Groups[i+2])
+		}
+
+		item.Value, err = strconv.ParseFloat(data, 64)
+		if err != nil {
+			return WrapError(err, "maximum demand", data)
+		}
+
+		c.MaximumDemandHistory = append(c.MaximumDemandHistory, item)
+	}
+
+	return nil
+}
+
+// applyDSMR22MBusReading parses the M-Bus reading of DSMR 2.2, which has the format
+// 0-n:24.3.0(timestamp)(08)(60)(1)(0-n:24.2.1)(unit)(reading), where the reading is on the next line.
+func applyDSMR22MBusReading(d *MBusDevice, v *Value) error {
+	if len(v.Groups) < 7 {
+		return WrapError(fmt.Errorf("invalid data format"), "M-Bus reading", fmt.Sprint(v.Groups))
+	}
+
+	var err error
+
+	d.Value, err = strconv.ParseFloat(v.Groups[6], 64)
+	if err != nil {
+		return WrapError(err, "M-Bus reading", v.Groups[6])
+	}
+	d.Unit = v.Groups[5]
+
+	d.MeasuredAt, err = v.ParseTimestamp(v.Groups[0])
+	if err != nil {
+		return WrapError(err, "M-Bus measurement time", v.Groups[0])
+	}
+
+	return nil
+}
@@ -1,23 +1,52 @@
 package smartmeter
 
 import (
+	"sort"
 	"time"
 )
 
 type P1Packet struct {
+	// Header is the identification line at the start of the telegram
+	Header Header
 	// DSMRVersion is the version information for P1 output (1-3:0.2.8)
 	DSMRVersion string
+	// EMUCSVersion is the version of the e-MUCS specification that Belgian meters send instead of DSMRVersion
+	// (0-0:96.1.4)
+	EMUCSVersion string
 	// Timestamp is the date-time stamp of the P1 message (0-0:1.0.0)
 	Timestamp time.Time
 
 	Electricity Electricity
-	Gas         Gas
-	Message     Message
-	Raw         [][]byte `json:"-"`
+	// Gas contains the first gas meter of MBus, for compatibility with meters that only have a gas meter
+	Gas Gas
+	// MBus contains all devices connected to the M-Bus channels of the meter, ordered by channel
+	MBus    []MBusDevice
+	Message Message
+
+	// Unknown contains the raw groups of all objects in the telegram that are not in the registry, keyed by OBIS code
+	Unknown map[string]string `json:",omitempty"`
+	// Extra contains the values of registered objects without an Apply function, keyed by OBIS code
+	Extra map[string]*Value `json:",omitempty"`
+
+	// Warnings contains the lines that were skipped because they could not be parsed in LenientMode
+	Warnings []Warning `json:",omitempty"`
+
+	Raw [][]byte `json:"-"`
+}
+
+// Warning describes a line of a telegram that could not be parsed.
+type Warning struct {
+	// Line is the 1-based line number in the telegram
+	Line int
+	// Code is the OBIS code of the line, or empty if the line does not have a valid format
+	Code string
+	// Message describes why the line could not be parsed
+	Message string
 }
 
 type Electricity struct {
-	// EquipmentID is the equipment identifier (0-0:96.1.1)
+	// EquipmentID is the equipment identifier (0-0:96.1.1), or the logical device name for Luxembourg Smarty meters
+	// (0-0:42.0.0)
 	EquipmentID string
 	// Tariff indicator for the electricity. (0-0:96.14.0)
 	Tariff int
@@ -25,10 +54,11 @@ type Electricity struct {
 	SwitchPosition int
 	// Threshold is the actual electricity threshold in the unit of ThresholdUnit (0-0:17.0.0)
 	Threshold float64
-	// ThresholdUnit is the unit of the Threshold, usually A or kW
+	// ThresholdUnit is the unit of the Threshold, usually A or kW, or kVA for Luxembourg Smarty meters
 	ThresholdUnit string
 
-	// Tariffs contains the client electricity delivery during the tariff, currently exactly two tariff2s.
+	// Tariffs contains the client electricity delivery per tariff, ordered by their number (1-0:1.8.n/1-0:2.8.n). It
+	// only contains the tariffs that are present in the telegram, usually tariff 1 and 2.
 	Tariffs []Tariff
 
 	// CurrentConsumed contains the actual electricity power delivered in kW (1-0:1.7.0)
@@ -36,26 +66,46 @@ type Electricity struct {
 	// CurrentProduced contains the actual electricity power produced in kW (1-0:2.7.0)
 	CurrentProduced float64
 
+	// ReactiveConsumed contains the reactive energy imported in kvarh, which is only sent by Luxembourg Smarty meters
+	// (1-0:3.8.0)
+	ReactiveConsumed float64
+	// ReactiveProduced contains the reactive energy exported in kvarh (1-0:4.8.0)
+	ReactiveProduced float64
+	// CurrentReactiveConsumed contains the actual reactive power imported in kvar (1-0:3.7.0)
+	CurrentReactiveConsumed float64
+	// CurrentReactiveProduced contains the actual reactive power exported in kvar (1-0:4.7.0)
+	CurrentReactiveProduced float64
+
 	// NumberOfPowerFailures contains the number of power failures in any phase (0-0:96.7.21)
 	NumberOfPowerFailures int
 	// NumberOfLongPowerFailures contains the number of long power failures in any phase (0-0:96.7.9)
 	NumberOfLongPowerFailures int
 
-	// Phases contains the data of phases, currently exactly three phases.
+	// Phases contains the data of the phases that are present in the telegram, ordered by their number, so single-phase
+	// meters only have one phase and meters that do not send any phase data have none.
 	Phases []Phase
 
 	// PowerFailureEventLog contains long power failures (1-0:99.97.0)
 	PowerFailureEventLog []PowerFailure
+
+	// CapacityTariff contains the values of the Belgian capacity tariff, which are only sent by e-MUCS meters. It is
+	// nil for other meters.
+	CapacityTariff *CapacityTariff `json:",omitempty"`
 }
 
 type Tariff struct {
-	// Consumed is the electricity delivered to client during this tariff in kWh (1-0:1.8.1/1-0:1.8.2)
+	// Number is the number of the tariff register, from 1 up to MaxTariffs, or 0 for the total of all tariffs that
+	// Luxembourg Smarty meters send instead of separate tariffs
+	Number int
+	// Consumed is the electricity delivered to client during this tariff in kWh (1-0:1.8.n)
 	Consumed float64
-	// Produced is the electricity delivered by client during this tariff in kWh (1-0:2.8.1/1-0:2.8.2)
+	// Produced is the electricity delivered by client during this tariff in kWh (1-0:2.8.n)
 	Produced float64
 }
 
 type Phase struct {
+	// Number is the number of the phase, 1 for L1 up to 3 for L3
+	Number int
 	// NumberOfVoltageSage contains the number of voltage sags in this phase (1-0:32.32.0/1-0:52.32.0/1-0:72.32.0)
 	NumberOfVoltageSags int
 	// NumberOfVoltageSwells contains the number of voltage swells in this phase (1-0:32.36.0/1-0:52.36.0/1-0:72.36.0)
@@ -78,6 +128,42 @@ type PowerFailure struct {
 	Duration time.Duration
 }
 
+type CapacityTariff struct {
+	// CurrentAverageDemand contains the average demand of the current quarter-hour in kW (1-0:1.4.0)
+	CurrentAverageDemand float64
+	// MaximumDemand contains the highest quarter-hour average demand of the current month (1-0:1.6.0)
+	MaximumDemand Demand
+	// MaximumDemandHistory contains the highest quarter-hour average demand of the last 13 months (0-0:98.1.0)
+	MaximumDemandHistory []MonthlyDemand
+}
+
+// RecordedHistory returns the months of the MaximumDemandHistory in which a demand was recorded. Meters send the months
+// that have not been recorded yet, such as the months before the meter was installed, with an unset timestamp, which
+// is parsed as the zero time.
+func (c *CapacityTariff) RecordedHistory() []MonthlyDemand {
+	var result []MonthlyDemand
+	for _, d := range c.MaximumDemandHistory {
+		if !d.Timestamp.IsZero() {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+type Demand struct {
+	// Timestamp contains the timestamp of the end of the quarter-hour in which the demand was reached
+	Timestamp time.Time
+	// Value contains the average demand in kW
+	Value float64
+}
+
+type MonthlyDemand struct {
+	// Month contains the timestamp of the start of the month after the month the demand was reached in
+	Month time.Time
+
+	Demand
+}
+
 type Message struct {
 	// Code is a text message code (0-0:96.13.1)
 	Code string
@@ -86,6 +172,8 @@ type Message struct {
 }
 
 type Gas struct {
+	// Channel is the M-Bus channel the gas meter is connected to, or 0 if there is no gas meter
+	Channel int
 	// EquipmentID is the equipment identifier (0-1:96.1.0)
 	EquipmentID string
 	// DeviceType is the device type (0-1:24.1.0)
@@ -97,3 +185,47 @@ type Gas struct {
 	// ValvePosition is the position of the gas valve (on/off/released) (0-1:24.4.0)
 	ValvePosition int
 }
+
+// capacityTariff returns the capacity tariff, creating it if this is the first capacity tariff value in the telegram.
+func (e *Electricity) capacityTariff() *CapacityTariff {
+	if e.CapacityTariff == nil {
+		e.CapacityTariff = &CapacityTariff{}
+	}
+	return e.CapacityTariff
+}
+
+// tariff returns the tariff with the number, adding it to Tariffs if it does not exist yet.
+func (e *Electricity) tariff(number int) *Tariff {
+	for i := range e.Tariffs {
+		if e.Tariffs[i].Number == number {
+			return &e.Tariffs[i]
+		}
+	}
+
+	e.Tariffs = append(e.Tariffs, Tariff{
+		Number: number,
+	})
+	sort.Slice(e.Tariffs, func(i, j int) bool {
+		return e.Tariffs[i].Number < e.Tariffs[j].Number
+	})
+
+	return e.tariff(number)
+}
+
+// phase returns the phase with the number, adding it to Phases if it does not exist yet.
+func (e *Electricity) phase(number int) *Phase {
+	for i := range e.Phases {
+		if e.Phases[i].Number == number {
+			return &e.Phases[i]
+		}
+	}
+
+	e.Phases = append(e.Phases, Phase{
+		Number: number,
+	})
+	sort.Slice(e.Phases, func(i, j int) bool {
+		return e.Phases[i].Number < e.Phases[j].Number
+	})
+
+	return e.phase(number)
+}
@@ -0,0 +1,79 @@
+package smartmeter
+
+import (
+	"bytes"
+)
+
+// MaxTelegramSize is the maximum size of a telegram in bytes. When no end of a telegram is found within this many bytes
+// after its start, the start is discarded and the scanner resynchronises on the next start of a telegram.
+const MaxTelegramSize = 16 * 1024
+
+// ScanTelegrams is a split function for a bufio.Scanner that returns each complete telegram from the / header line up to
+// and including the line ending of the !CRC line. Any data that is not part of a telegram is discarded: data before
+// the first /, telegrams that are interrupted by a new telegram starting on a new line and telegrams that exceed
+// MaxTelegramSize.
+func ScanTelegrams(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for {
+		start := bytes.IndexByte(data[advance:], '/')
+		if start < 0 {
+			// Everything we have is garbage, so there is no need to keep it around
+			return len(data), nil, nil
+		}
+		start += advance
+
+		end, restart := findTelegramEnd(data[start:], atEOF)
+		switch {
+		case end > 0:
+			return start + end, data[start : start+end], nil
+		case restart > 0:
+			// A new telegram started before the end of the current one, so discard the incomplete one
+			advance = start + restart
+		case atEOF:
+			// The telegram will never be completed
+			return len(data), nil, nil
+		case len(data)-start > MaxTelegramSize:
+			// Skip this start and look for the next one
+			advance = start + 1
+		default:
+			// Drop any garbage before the start of the telegram and request more data
+			return start, nil, nil
+		}
+	}
+}
+
+// findTelegramEnd returns the length of the telegram at the start of data including the line ending of the ! line, or
+// the offset of the start of a new telegram if one starts before the end of this telegram. If neither is found, both
+// are 0. Only a / or ! at the start of a line is a delimiter, since text messages and equipment identifiers may contain
+// them as well.
+func findTelegramEnd(data []byte, atEOF bool) (end, restart int) {
+	// Start looking at the line after the header line, since the header itself may contain a ! or /
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return 0, 0
+	}
+	i++
+
+	for i < len(data) {
+		switch data[i] {
+		case '/':
+			return 0, i
+		case '!':
+			lineEnd := bytes.IndexByte(data[i:], '\n')
+			if lineEnd >= 0 {
+				return i + lineEnd + 1, 0
+			}
+			if atEOF {
+				return len(data), 0
+			}
+			return 0, 0
+		}
+
+		lineEnd := bytes.IndexByte(data[i:], '\n')
+		if lineEnd < 0 {
+			break
+		}
+		i += lineEnd + 1
+	}
+
+	return 0, 0
+}
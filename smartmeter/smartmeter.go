@@ -3,433 +3,212 @@ package smartmeter
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
-	"regexp"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const dateFormat = "060102150405"
 
-var newGasFormat = regexp.MustCompile(`^0-1:24\.2\.1\((\d+)([SW])\)\((\d{5}\.\d{3})\*m3\)$`)
-var oldGasFormat = regexp.MustCompile(`^0-1:24\.3\.0\((\d+)\)`)
-var oldGasFormatNextLine = regexp.MustCompile(`^\((\d{5}.\d{3})\)$`)
+// DefaultTimezone is the timezone of the timestamps in telegrams when Options.Timezone is empty
+const DefaultTimezone = "Europe/Amsterdam"
+
+// unsetTimestamp is sent by e-MUCS meters for timestamps that have not been set yet
+const unsetTimestamp = "632525252525"
 
 type SmartMeter struct {
-	r io.Reader
-	l Logger
+	r       io.Reader
+	scanner *bufio.Scanner
+	l       Logger
+
+	options  Options
+	location *time.Location
+	registry *Registry
+
+	closeOnce sync.Once
+}
+
+type Options struct {
+	SkipChecksum bool   `env:"PARSER_SKIP_CHECKSUM" flag:"skip-checksum" desc:"skip CRC16 validation of DSMR 4/5 telegrams"`
+	Timezone     string `env:"PARSER_TIMEZONE" flag:"timezone" desc:"IANA timezone of the timestamps in telegrams, defaults to Europe/Amsterdam, which is loaded from the timezone database of the host unless the program embeds time/tzdata"`
+	Mode         Mode   `env:"PARSER_MODE" flag:"mode" desc:"strict to fail on any line that cannot be parsed, lenient to skip those lines and add a warning to the packet"`
+}
+
+// New returns a SmartMeter that reads telegrams from r and recognises the OBIS objects in the DefaultRegistry. The
+// reader may be nil when telegrams are only passed to Parse.
+//
+// The timezone is loaded with time.LoadLocation, which uses the timezone database of the host. Programs that run on
+// hosts without one, such as containers, should import time/tzdata.
+func New(r io.Reader, options Options) (*SmartMeter, error) {
+	return NewWithRegistry(r, options, DefaultRegistry)
 }
 
-func New(r io.Reader) (*SmartMeter, error) {
+// NewWithRegistry returns a SmartMeter like New that recognises the OBIS objects in registry instead. A nil registry
+// is the same as the DefaultRegistry.
+func NewWithRegistry(r io.Reader, options Options, registry *Registry) (*SmartMeter, error) {
+	timezone := options.Timezone
+	if timezone == "" {
+		timezone = DefaultTimezone
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Split(ScanTelegrams)
+
 	return &SmartMeter{
-		r: r,
-		l: NewStderrLog(),
+		r:       r,
+		scanner: scanner,
+		l:       NewStderrLog(),
+
+		options:  options,
+		location: location,
+		registry: registry,
 	}, nil
 }
 
+// Read reads the next telegram from the reader and parses it. Data that was read past the end of the telegram is kept
+// for the next call to Read. When the reader is exhausted, io.EOF is returned.
 func (sm *SmartMeter) Read() (*P1Packet, error) {
-	var datagram [][]byte
-	var linesRead int
-	var startFound bool
-	var endFound bool
-
-	scanner := bufio.NewScanner(sm.r)
-
-	for !startFound || !endFound {
-		if !scanner.Scan() {
-			return nil, fmt.Errorf("failed to find enough data: %v", scanner.Err())
+	if !sm.scanner.Scan() {
+		if err := sm.scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read telegram: %w", err)
 		}
+		return nil, io.EOF
+	}
 
-		line := scanner.Bytes()
-
-		linesRead++
+	return sm.Parse(sm.scanner.Bytes())
+}
 
-		if bytes.ContainsRune(line, '/') {
-			startFound = true
-			endFound = false
-			datagram = append(datagram, bytes.TrimSpace(line))
-		} else if bytes.ContainsRune(line, '!') {
-			endFound = true
-			datagram = append(datagram, bytes.TrimSpace(line))
-		} else {
-			datagram = append(datagram, bytes.TrimSpace(line))
+// Parse parses a single complete telegram, such as a telegram returned by a bufio.Scanner with ScanTelegrams. The
+// checksum is verified unless SkipChecksum is set.
+func (sm *SmartMeter) Parse(telegram []byte) (*P1Packet, error) {
+	if !sm.options.SkipChecksum {
+		if err := verifyChecksum(telegram); err != nil {
+			return nil, err
 		}
 	}
 
+	var datagram [][]byte
+	for _, line := range bytes.Split(bytes.TrimRight(telegram, "\r\n"), []byte("\n")) {
+		datagram = append(datagram, bytes.Clone(bytes.TrimSpace(line)))
+	}
+
 	return sm.parsePacket(datagram)
 }
 
 func (sm *SmartMeter) parsePacket(datagram [][]byte) (*P1Packet, error) {
 	p := &P1Packet{
 		Timestamp: time.Now(),
-		Electricity: Electricity{
-			Tariffs: make([]Tariff, 2),
-			Phases:  make([]Phase, 3),
-		},
-		Raw: datagram,
+		Raw:       datagram,
 	}
-	var err error
 
-	for i, line := range datagram {
-		dataStart := bytes.IndexRune(line, '(')
-		dataEnd := bytes.IndexRune(line, ')')
-		if dataStart < 0 || dataEnd < 0 || dataEnd <= dataStart {
-			continue
-		}
-		identifier := string(line[:dataStart])
-		data := string(line[dataStart+1 : dataEnd])
-
-		switch identifier {
-		case "1-3:0.2.8":
-			p.DSMRVersion = data
-		case "0-0:1.0.0":
-			p.Timestamp, err = time.ParseInLocation(dateFormat, data[:len(data)-1], time.Local)
-			if err != nil {
-				return nil, WrapError(err, "timestamp", data)
-			}
-		case "0-0:96.1.1":
-			p.Electricity.EquipmentID = data
-		case "0-0:96.14.0":
-			p.Electricity.Tariff, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "tariff", data)
-			}
-		case "0-0:96.3.10":
-			p.Electricity.SwitchPosition, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "switch position", data)
-			}
-		case "0-0:17.0.0":
-			data, p.Electricity.ThresholdUnit = sm.getValueAndUnit(data)
-			p.Electricity.Threshold, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "threshold", data)
-			}
-		case "1-0:1.8.1":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kWh" {
-				return nil, fmt.Errorf("invalid unit for electricity delivery: %v", unit)
-			}
-			p.Electricity.Tariffs[0].Consumed, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "electricity delivery", data)
-			}
-		case "1-0:1.8.2":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kWh" {
-				return nil, fmt.Errorf("invalid unit for electricity delivery: %v", unit)
-			}
-			p.Electricity.Tariffs[1].Consumed, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "electricity delivery", data)
-			}
-		case "1-0:2.8.1":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kWh" {
-				return nil, fmt.Errorf("invalid unit for electricity delivery: %v", unit)
-			}
-			p.Electricity.Tariffs[0].Produced, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "electricity delivery", data)
-			}
-		case "1-0:2.8.2":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kWh" {
-				return nil, fmt.Errorf("invalid unit for electricity delivery: %v", unit)
-			}
-			p.Electricity.Tariffs[1].Produced, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "electricity delivery", data)
-			}
-		case "1-0:1.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kW" {
-				return nil, fmt.Errorf("invalid unit for electricity usage: %v", unit)
-			}
-			p.Electricity.CurrentConsumed, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "electricity usage", data)
-			}
-		case "1-0:2.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kW" {
-				return nil, fmt.Errorf("invalid unit for electricity usage: %v", unit)
-			}
-			p.Electricity.CurrentProduced, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "electricity usage", data)
-			}
-		case "0-0:96.7.21":
-			p.Electricity.NumberOfPowerFailures, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "number of power failures", data)
-			}
-		case "0-0:96.7.9":
-			p.Electricity.NumberOfLongPowerFailures, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "number of long power failures", data)
-			}
-		case "1-0:32.32.0":
-			p.Electricity.Phases[0].NumberOfVoltageSags, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "number of power voltage sags in phase L1", data)
-			}
-		case "1-0:52.32.0":
-			p.Electricity.Phases[1].NumberOfVoltageSags, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "number of power voltage sags in phase L2", data)
-			}
-		case "1-0:72.32.0":
-			p.Electricity.Phases[2].NumberOfVoltageSags, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "number of power voltage sags in phase L3", data)
-			}
-		case "1-0:32.36.0":
-			p.Electricity.Phases[0].NumberOfVoltageSwells, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "number of power voltage swells in phase L1", data)
-			}
-		case "1-0:52.36.0":
-			p.Electricity.Phases[1].NumberOfVoltageSwells, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "number of power voltage swells in phase L2", data)
-			}
-		case "1-0:72.36.0":
-			p.Electricity.Phases[2].NumberOfVoltageSwells, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "number of power voltage swells in phase L3", data)
-			}
-		case "1-0:32.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "V" {
-				return nil, fmt.Errorf("invalid unit for instantaneous voltage in phase L1: %v", unit)
-			}
-			p.Electricity.Phases[0].InstantaneousVoltage, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous voltage in phase L1", data)
-			}
-		case "1-0:52.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "V" {
-				return nil, fmt.Errorf("invalid unit for instantaneous voltage in phase L2: %v", unit)
-			}
-			p.Electricity.Phases[1].InstantaneousVoltage, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous voltage in phase L2", data)
-			}
-		case "1-0:72.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "V" {
-				return nil, fmt.Errorf("invalid unit for instantaneous voltage in phase L3: %v", unit)
-			}
-			p.Electricity.Phases[2].InstantaneousVoltage, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous voltage in phase L3", data)
-			}
-		case "1-0:31.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "A" {
-				return nil, fmt.Errorf("invalid unit for instantaneous current in phase L1: %v", unit)
-			}
-			p.Electricity.Phases[0].InstantaneousCurrent, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous current in phase L1", data)
-			}
-		case "1-0:51.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "A" {
-				return nil, fmt.Errorf("invalid unit for instantaneous current in phase L2: %v", unit)
-			}
-			p.Electricity.Phases[1].InstantaneousCurrent, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous current in phase L2", data)
-			}
-		case "1-0:71.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "A" {
-				return nil, fmt.Errorf("invalid unit for instantaneous current in phase L3: %v", unit)
-			}
-			p.Electricity.Phases[2].InstantaneousCurrent, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous current in phase L3", data)
-			}
-		case "1-0:21.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kW" {
-				return nil, fmt.Errorf("invalid unit for instantaneous active power P+ in phase L1: %v", unit)
-			}
-			p.Electricity.Phases[0].InstantaneousActivePositivePower, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous active power P+ in phase L1", data)
-			}
-		case "1-0:41.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kW" {
-				return nil, fmt.Errorf("invalid unit for instantaneous active power P+ in phase L2: %v", unit)
-			}
-			p.Electricity.Phases[1].InstantaneousActivePositivePower, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous active power P+ in phase L2", data)
-			}
-		case "1-0:61.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kW" {
-				return nil, fmt.Errorf("invalid unit for instantaneous active power P+ in phase L3: %v", unit)
-			}
-			p.Electricity.Phases[2].InstantaneousActivePositivePower, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous active power P+ in phase L3", data)
-			}
-		case "1-0:22.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kW" {
-				return nil, fmt.Errorf("invalid unit for instantaneous active power P- in phase L1: %v", unit)
-			}
-			p.Electricity.Phases[0].InstantaneousActiveNegativePower, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous active power P- in phase L1", data)
-			}
-		case "1-0:42.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kW" {
-				return nil, fmt.Errorf("invalid unit for instantaneous active power P- in phase L2: %v", unit)
-			}
-			p.Electricity.Phases[1].InstantaneousActiveNegativePower, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous active power P- in phase L2", data)
-			}
-		case "1-0:62.7.0":
-			data, unit := sm.getValueAndUnit(data)
-			if unit != "kW" {
-				return nil, fmt.Errorf("invalid unit for instantaneous active power P- in phase L3: %v", unit)
-			}
-			p.Electricity.Phases[2].InstantaneousActiveNegativePower, err = strconv.ParseFloat(data, 64)
-			if err != nil {
-				return nil, WrapError(err, "instantaneous active power P- in phase L3", data)
-			}
-		case "1-0:99.97.0":
-			numberOfPowerFailures, err := strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "number of power failures", data)
-			}
-
-			index := dataEnd + 1
-			lineData := line[index:]
+	if len(datagram) > 0 {
+		p.Header = parseHeader(string(datagram[0]))
+	}
 
-			nextDataStart := bytes.IndexRune(lineData, '(')
-			nextDataEnd := bytes.IndexRune(lineData, ')')
-			if nextDataStart < 0 || nextDataEnd < 0 {
-				continue
+	for _, line := range joinContinuationLines(datagram) {
+		if err := sm.parseLine(p, line); err != nil {
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
 			}
-			data := string(lineData[nextDataStart+1 : nextDataEnd])
 
-			if data != "0-0:96.7.19" {
-				return nil, WrapError(fmt.Errorf("invalid data format"), "power failure event log", data)
+			parseErr.Line = line.number
+			if sm.options.Mode == StrictMode {
+				return nil, parseErr
 			}
 
-			for i := 0; i < numberOfPowerFailures; i++ {
-				item := PowerFailure{}
+			p.Warnings = append(p.Warnings, Warning{
+				Line:    parseErr.Line,
+				Code:    parseErr.Code,
+				Message: parseErr.Error(),
+			})
+		}
+	}
+
+	p.Gas = gasFromMBus(p.MBus)
 
-				index = nextDataEnd + 1
-				lineData = lineData[index:]
+	return p, nil
+}
 
-				nextDataStart = bytes.IndexRune(lineData, '(')
-				nextDataEnd = bytes.IndexRune(lineData, ')')
-				if nextDataStart < 0 || nextDataEnd < 0 {
-					continue
-				}
+func (sm *SmartMeter) parseLine(p *P1Packet, line telegramLine) error {
+	if line.text == "" || line.text[0] == '/' || line.text[0] == '!' {
+		return nil
+	}
 
-				data := string(lineData[nextDataStart+1 : nextDataEnd])
+	code, groups, ok := splitLine(line.text)
+	if !ok {
+		return WrapError(errors.New("invalid format"), "line", line.text)
+	}
 
-				item.Timestamp, err = time.ParseInLocation(dateFormat, data[:len(data)-1], time.Local)
-				if err != nil {
-					return nil, WrapError(err, "power failure timestamp", data)
-				}
+	object, ok := sm.registry.Lookup(code)
+	if !ok {
+		if p.Unknown == nil {
+			p.Unknown = make(map[string]string)
+		}
+		p.Unknown[code] = line.text[strings.IndexByte(line.text, '('):]
+		return nil
+	}
 
-				index = nextDataEnd + 1
-				lineData = lineData[index:]
+	value, err := parseValue(code, groups, object, sm.location)
+	if err == nil {
+		if object.Apply == nil {
+			if p.Extra == nil {
+				p.Extra = make(map[string]*Value)
+			}
+			p.Extra[code] = value
+			return nil
+		}
 
-				nextDataStart = bytes.IndexRune(lineData, '(')
-				nextDataEnd = bytes.IndexRune(lineData, ')')
-				if nextDataStart < 0 || nextDataEnd < 0 {
-					continue
-				}
+		err = object.Apply(p, value)
+	}
 
-				data = string(lineData[nextDataStart+1 : nextDataEnd])
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.Code = code
+	}
 
-				data, unit := sm.getValueAndUnit(data)
-				if unit != "s" {
-					return nil, fmt.Errorf("invalid unit for power failure event log duration: %v", unit)
-				}
+	return err
+}
 
-				duration, err := strconv.Atoi(data)
-				if err != nil {
-					return nil, WrapError(err, "power failure duration", data)
-				}
+// telegramLine is a line of a telegram with its 1-based line number.
+type telegramLine struct {
+	number int
+	text   string
+}
 
-				item.Duration = time.Duration(duration) * time.Second
+// joinContinuationLines joins lines that start with a ( to the previous line, since some objects, such as the gas
+// reading of DSMR 2.2, span multiple lines. Lines following a line with an unclosed group, such as a long text message
+// that is wrapped, are joined as well.
+func joinContinuationLines(datagram [][]byte) []telegramLine {
+	lines := make([]telegramLine, 0, len(datagram))
 
-				p.Electricity.PowerFailureEventLog = append(p.Electricity.PowerFailureEventLog, item)
-			}
-		case "0-1:96.1.0":
-			p.Gas.EquipmentID = data
-		case "0-1:24.1.0":
-			p.Gas.DeviceType, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "device type", data)
-			}
-		case "0-1:24.4.0":
-			p.Gas.ValvePosition, err = strconv.Atoi(data)
-			if err != nil {
-				return nil, WrapError(err, "valve position", data)
-			}
-		case "0-1:24.2.1":
-			result := newGasFormat.FindStringSubmatch(string(line))
-			if result == nil {
-				return nil, WrapError(fmt.Errorf("no regex match"), "gas format", string(line))
-			}
-			p.Gas.Consumed, err = strconv.ParseFloat(result[3], 64)
-			if err != nil {
-				return nil, WrapError(err, "gas consumption", result[3])
-			}
-			p.Gas.MeasuredAt, err = time.Parse(dateFormat, result[1])
-			if err != nil {
-				return nil, WrapError(err, "gas measurement time", result[1])
-			}
-		case "0-1:24.3.0":
-			result := oldGasFormatNextLine.FindStringSubmatch(string(datagram[i+1]))
-			if result == nil {
-				return nil, WrapError(fmt.Errorf("no regex match"), "gas format", string(line))
-			}
-			p.Gas.Consumed, err = strconv.ParseFloat(result[1], 64)
-			if err != nil {
-				return nil, WrapError(err, "gas consumption", result[3])
-			}
-			result = oldGasFormat.FindStringSubmatch(string(line))
-			if result == nil {
-				return nil, WrapError(fmt.Errorf("no regex match"), "gas format", string(line))
-			}
-			p.Gas.MeasuredAt, err = time.Parse(dateFormat, result[1])
-			if err != nil {
-				return nil, WrapError(err, "gas measurement time", result[1])
-			}
-		case "0-0:96.13.1":
-			p.Message.Code = data
-		case "0-0:96.13.0":
-			p.Message.Text = data
+	for i, line := range datagram {
+		if len(lines) > 0 && ((len(line) > 0 && line[0] == '(') || hasUnclosedGroup(lines[len(lines)-1].text)) {
+			lines[len(lines)-1].text += string(line)
+			continue
 		}
+
+		lines = append(lines, telegramLine{
+			number: i + 1,
+			text:   string(line),
+		})
 	}
 
-	return p, nil
+	return lines
 }
 
-func (sm *SmartMeter) getValueAndUnit(data string) (string, string) {
-	index := strings.LastIndex(data, "*")
-	if index < 0 {
-		return data, ""
-	}
-
-	return data[:index], data[index+1:]
+func hasUnclosedGroup(line string) bool {
+	return strings.LastIndexByte(line, '(') > strings.LastIndexByte(line, ')')
 }
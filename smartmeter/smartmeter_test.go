@@ -1,9 +1,20 @@
 package smartmeter_test
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/koesie10/smartmeter/smartmeter"
 )
@@ -20,20 +31,748 @@ func TestESMR50(t *testing.T) {
 	testFile(t, "esmr50.txt")
 }
 
-func testFile(t *testing.T, file string) {
+func TestChecksumMismatch(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("1-0:1.8.1(000000.855*kWh)"), []byte("1-0:1.8.1(900000.855*kWh)"), 1)
+
+	sm, err := smartmeter.New(bytes.NewReader(data), smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sm.Read()
+	var checksumErr *smartmeter.ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	if checksumErr.Expected != 0x60EB {
+		t.Errorf("expected checksum 60EB, got %04X", checksumErr.Expected)
+	}
+
+	sm, err = smartmeter.New(bytes.NewReader(data), smartmeter.Options{SkipChecksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sm.Read(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMissingChecksum(t *testing.T) {
+	for _, file := range []string{"dsmr40.txt", "esmr50.txt", "emucs.txt"} {
+		data, err := os.ReadFile(filepath.Join("test", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Remove the checksum, as if the telegram was truncated after the !
+		end := bytes.LastIndexByte(data, '!')
+		data = append(data[:end+1:end+1], "\r\n"...)
+
+		sm, err := smartmeter.New(bytes.NewReader(data), smartmeter.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var parseErr *smartmeter.ParseError
+		if _, err := sm.Read(); !errors.As(err, &parseErr) || parseErr.Type != "checksum" {
+			t.Errorf("%s: expected checksum parse error, got %v", file, err)
+		}
+
+		sm, err = smartmeter.New(bytes.NewReader(data), smartmeter.Options{SkipChecksum: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := sm.Read(); err != nil {
+			t.Errorf("%s: expected telegram to be accepted with SkipChecksum, got %v", file, err)
+		}
+	}
+}
+
+func TestConsecutiveTelegrams(t *testing.T) {
+	var data []byte
+	data = append(data, "garbage\r\n"...)
+	for _, file := range []string{"esmr50.txt", "dsmr40.txt", "dsmr22.txt"} {
+		telegram, err := os.ReadFile(filepath.Join("test", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, telegram...)
+		// An interrupted telegram should be skipped when the next telegram starts on a new line
+		data = append(data, "/ISk5\\2MT382-1000\r\n1-0:1.8.1(123\r\n"...)
+	}
+
+	sm, err := smartmeter.New(iotest.OneByteReader(bytes.NewReader(data)), smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, equipmentID := range []string{"serienummer", "4B384547303034303436333935353037", "205C4D246333034353537383234323121"} {
+		packet, err := sm.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.Electricity.EquipmentID != equipmentID {
+			t.Errorf("expected equipment ID %q, got %q", equipmentID, packet.Electricity.EquipmentID)
+		}
+	}
+
+	if _, err := sm.Read(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestScanTelegramsDelimitersInLines(t *testing.T) {
+	first := "/KMP5 ZABF001587315111\r\n" +
+		"0-0:96.1.1(205C4D246333034353537383234323121)\r\n" +
+		"0-0:96.13.0(Storing 1/2! Bel 0800-1234)\r\n" +
+		"0-1:96.1.0(3238313031453631373038389930337131/!)\r\n" +
+		"!\r\n"
+	second := "/ISk5\\2MT382-1000\r\n" +
+		"0-0:96.13.0(a!b/c)\r\n" +
+		"!\r\n"
+
+	scanner := bufio.NewScanner(iotest.OneByteReader(strings.NewReader("garbage\r\n" + first + second)))
+	scanner.Split(smartmeter.ScanTelegrams)
+
+	for _, expected := range []string{first, second} {
+		if !scanner.Scan() {
+			t.Fatalf("expected telegram, got %v", scanner.Err())
+		}
+		if scanner.Text() != expected {
+			t.Errorf("expected telegram %q, got %q", expected, scanner.Text())
+		}
+	}
+
+	if scanner.Scan() {
+		t.Errorf("expected no more telegrams, got %q", scanner.Text())
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, w := io.Pipe()
+	go w.Write(data)
+
+	sm, err := smartmeter.New(r, smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := sm.Stream(ctx)
+
+	result := <-results
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	// The stream is now blocked waiting for the next telegram
+	cancel()
+
+	select {
+	case _, ok := <-results:
+		if ok {
+			t.Fatal("expected stream to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream did not stop after cancellation")
+	}
+
+	if _, err := w.Write(data); err != io.ErrClosedPipe {
+		t.Fatalf("expected reader to be closed, got %v", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("test", "esmr50.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("0-0:96.13.0()"), []byte("0-0:96.13.0()\r\n1-0:14.7.0(50.01*Hz)\r\n1-0:99.1.0(3)(12.5*kW)"), 1)
+
+	read := func(registry *smartmeter.Registry) *smartmeter.P1Packet {
+		sm, err := smartmeter.NewWithRegistry(bytes.NewReader(data), smartmeter.Options{SkipChecksum: true}, registry)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packet, err := sm.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packet
+	}
+
+	packet := read(nil)
+	if packet.Unknown["1-0:14.7.0"] != "(50.01*Hz)" {
+		t.Errorf("expected unknown object to be kept, got %v", packet.Unknown)
+	}
+
+	registry := smartmeter.NewDefaultRegistry()
+	registry.Register("1-0:14.7.0", smartmeter.OBISObject{
+		Name:  "frequency",
+		Units: []string{"Hz"},
+		Type:  smartmeter.FloatValue,
+	})
+	// The first group is not a timestamp, so it must not be parsed as one
+	registry.Register("1-0:99.1.0", smartmeter.OBISObject{
+		Name:  "demand of a phase",
+		Units: []string{"kW"},
+		Type:  smartmeter.FloatValue,
+	})
+
+	packet = read(registry)
+	if _, ok := packet.Unknown["1-0:14.7.0"]; ok {
+		t.Errorf("expected registered object to not be unknown")
+	}
+	if v := packet.Extra["1-0:14.7.0"]; v == nil || v.Float != 50.01 || v.Unit != "Hz" {
+		t.Errorf("expected registered object to be parsed, got %+v", v)
+	}
+	if v := packet.Extra["1-0:99.1.0"]; v == nil || v.Float != 12.5 || v.Groups[0] != "3" || !v.Timestamp.IsZero() {
+		t.Errorf("expected registered object with multiple groups to be parsed, got %+v", v)
+	}
+	if len(packet.Warnings) != 0 {
+		t.Errorf("expected no warnings, got %v", packet.Warnings)
+	}
+
+	if _, ok := smartmeter.DefaultRegistry.Lookup("1-0:14.7.0"); ok {
+		t.Errorf("expected the default registry to be unaffected")
+	}
+	if packet := read(nil); packet.Unknown["1-0:14.7.0"] != "(50.01*Hz)" {
+		t.Errorf("expected unknown object with the default registry, got %v", packet.Unknown)
+	}
+}
+
+func TestMBus(t *testing.T) {
+	packet := testFile(t, "esmr50_mbus.txt")
+
+	expected := []struct {
+		channel int
+		kind    string
+		value   float64
+		unit    string
+	}{
+		{1, "gas", 1.29, "m3"},
+		{2, "water", 12.345, "m3"},
+		{3, "heat", 1.234, "GJ"},
+	}
+
+	if len(packet.MBus) != len(expected) {
+		t.Fatalf("expected %d M-Bus devices, got %d", len(expected), len(packet.MBus))
+	}
+
+	for i, e := range expected {
+		device := packet.MBus[i]
+		if device.Channel != e.channel || device.Kind() != e.kind || device.Value != e.value || device.Unit != e.unit {
+			t.Errorf("expected M-Bus device %+v, got %+v", e, device)
+		}
+	}
+
+	if packet.Gas.Consumed != 1.29 {
+		t.Errorf("expected gas consumption of 1.29, got %v", packet.Gas.Consumed)
+	}
+}
+
+func TestCapacityTariff(t *testing.T) {
+	packet := testFile(t, "emucs.txt")
+
+	c := packet.Electricity.CapacityTariff
+	if c == nil {
+		t.Fatal("expected capacity tariff to be parsed")
+	}
+
+	if c.CurrentAverageDemand != 2.351 {
+		t.Errorf("expected current average demand of 2.351, got %v", c.CurrentAverageDemand)
+	}
+	if c.MaximumDemand.Value != 2.589 || c.MaximumDemand.Timestamp.Day() != 9 {
+		t.Errorf("expected maximum demand of 2.589 on the 9th, got %+v", c.MaximumDemand)
+	}
+
+	expected := []float64{3.695, 5.980, 4.318}
+	if len(c.MaximumDemandHistory) != len(expected) {
+		t.Fatalf("expected %d months of maximum demand history, got %d", len(expected), len(c.MaximumDemandHistory))
+	}
+	for i, value := range expected {
+		if c.MaximumDemandHistory[i].Value != value {
+			t.Errorf("expected maximum demand %v in month %d, got %v", value, i, c.MaximumDemandHistory[i].Value)
+		}
+	}
+
+	if packet.Gas.Consumed != 112.384 || packet.Gas.EquipmentID != "37464C4F32313139303333373333" {
+		t.Errorf("expected gas to be parsed, got %+v", packet.Gas)
+	}
+}
+
+func TestCapacityTariffUnsetMonths(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("test", "emucs.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a month that has not been recorded yet
+	data = bytes.Replace(data, []byte("0-0:98.1.0(3)"), []byte("0-0:98.1.0(4)"), 1)
+	data = bytes.Replace(data, []byte("(04.318*kW)"), []byte("(04.318*kW)(632525252525W)(632525252525W)(00.000*kW)"), 1)
+
+	sm, err := smartmeter.New(bytes.NewReader(data), smartmeter.Options{SkipChecksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet, err := sm.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := packet.Electricity.CapacityTariff
+	if len(c.MaximumDemandHistory) != 4 {
+		t.Fatalf("expected 4 months of maximum demand history, got %d", len(c.MaximumDemandHistory))
+	}
+
+	recorded := c.RecordedHistory()
+	if len(recorded) != 3 {
+		t.Fatalf("expected 3 recorded months, got %+v", recorded)
+	}
+	for _, d := range recorded {
+		if d.Timestamp.IsZero() {
+			t.Errorf("expected months without timestamp to be skipped, got %+v", d)
+		}
+	}
+}
+
+func TestTariffsAndPhases(t *testing.T) {
+	tests := []struct {
+		file    string
+		tariffs int
+		phases  int
+	}{
+		{"dsmr22.txt", 2, 0},
+		{"esmr50.txt", 2, 3},
+		{"emucs.txt", 2, 1},
+	}
+
+	for _, tt := range tests {
+		packet := testFile(t, tt.file)
+
+		if len(packet.Electricity.Tariffs) != tt.tariffs {
+			t.Errorf("%s: expected %d tariffs, got %d", tt.file, tt.tariffs, len(packet.Electricity.Tariffs))
+		}
+		if len(packet.Electricity.Phases) != tt.phases {
+			t.Errorf("%s: expected %d phases, got %d", tt.file, tt.phases, len(packet.Electricity.Phases))
+		}
+	}
+
+	telegram := "/ISk5\\2MT382-1000\r\n\r\n" +
+		"1-0:1.8.1(000001.000*kWh)\r\n" +
+		"1-0:1.8.4(000004.000*kWh)\r\n" +
+		"1-0:2.8.3(000003.000*kWh)\r\n" +
+		"!\r\n"
+
+	sm, err := smartmeter.New(bytes.NewReader([]byte(telegram)), smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet, err := sm.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tariff 2 is not present in the telegram, so it must not be reported as a tariff without any delivery
+	expected := []smartmeter.Tariff{{Number: 1, Consumed: 1}, {Number: 3, Produced: 3}, {Number: 4, Consumed: 4}}
+	if len(packet.Electricity.Tariffs) != len(expected) {
+		t.Fatalf("expected %d tariffs, got %d", len(expected), len(packet.Electricity.Tariffs))
+	}
+	for i, tariff := range expected {
+		if packet.Electricity.Tariffs[i] != tariff {
+			t.Errorf("expected tariff %d to be %+v, got %+v", tariff.Number, tariff, packet.Electricity.Tariffs[i])
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		file           string
+		manufacturerID string
+		manufacturer   string
+		identification string
+	}{
+		{"dsmr22.txt", "KMP", "Kamstrup", "ZABF001587315111"},
+		{"esmr50.txt", "Ene", "Sagemcom", "T210-D ESMR5.0"},
+		{"emucs.txt", "FLU", "Fluvius", "253769484_A"},
+		{"smarty.txt", "Lux", "Lux", `u\SMARTY`},
+	}
+
+	for _, tt := range tests {
+		header := testFile(t, tt.file).Header
+
+		if header.ManufacturerID != tt.manufacturerID || header.Manufacturer() != tt.manufacturer || header.BaudRate != "5" || header.Identification != tt.identification {
+			t.Errorf("%s: unexpected header %+v with manufacturer %q", tt.file, header, header.Manufacturer())
+		}
+	}
+}
+
+func TestDaylightSavingTime(t *testing.T) {
+	// On 29 October 2023 the clock was set back from 03:00 CEST to 02:00 CET, so 02:30 occurred twice
+	telegram := "/ISk5\\2MT382-1000\r\n\r\n" +
+		"0-0:1.0.0(231029023000%s)\r\n" +
+		"0-1:24.2.1(231029023000%s)(00012.345*m3)\r\n" +
+		"!\r\n"
+
+	tests := []struct {
+		flag     string
+		expected time.Time
+	}{
+		{"S", time.Date(2023, 10, 29, 0, 30, 0, 0, time.UTC)},
+		{"W", time.Date(2023, 10, 29, 1, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		sm, err := smartmeter.New(bytes.NewReader([]byte(fmt.Sprintf(telegram, tt.flag, tt.flag))), smartmeter.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packet, err := sm.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !packet.Timestamp.Equal(tt.expected) {
+			t.Errorf("%s: expected timestamp %v, got %v", tt.flag, tt.expected, packet.Timestamp.UTC())
+		}
+		if !packet.Gas.MeasuredAt.Equal(tt.expected) {
+			t.Errorf("%s: expected gas timestamp %v, got %v", tt.flag, tt.expected, packet.Gas.MeasuredAt.UTC())
+		}
+	}
+
+	if _, err := smartmeter.New(bytes.NewReader(nil), smartmeter.Options{Timezone: "Invalid/Timezone"}); err == nil {
+		t.Error("expected error for invalid timezone")
+	}
+}
+
+func TestMessage(t *testing.T) {
+	packet := testFile(t, "dsmr40.txt")
+
+	if packet.Message.Code != "01 61 81" {
+		t.Errorf("expected decoded message code, got %q", packet.Message.Code)
+	}
+
+	// The message in the telegram is wrapped over two lines
+	if expected := strings.Repeat("0123456789:;<=>?", 5); packet.Message.Text != expected {
+		t.Errorf("expected decoded message %q, got %q", expected, packet.Message.Text)
+	}
+}
+
+func TestMessageDSMR22(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("test", "dsmr22.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("0-0:96.13.1()"), []byte("0-0:96.13.1(12345678)"), 1)
+	data = bytes.Replace(data, []byte("0-0:96.13.0()"), []byte("0-0:96.13.0(CAFE Storing)"), 1)
+
+	sm, err := smartmeter.New(bytes.NewReader(data), smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet, err := sm.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// DSMR 2.2 sends the message as-is, even if it happens to be valid hex
+	if packet.Message.Code != "12345678" {
+		t.Errorf("expected numeric message code, got %q", packet.Message.Code)
+	}
+	if packet.Message.Text != "CAFE Storing" {
+		t.Errorf("expected plain text message, got %q", packet.Message.Text)
+	}
+}
+
+func TestLenientMode(t *testing.T) {
+	telegram := "/ISk5\\2MT382-1000\r\n\r\n" +
+		"1-0:1.8.1(000001.000*kWh)\r\n" +
+		"1-0:31.7.0(abc*A)\r\n" +
+		"1-0:32.7.0(230.0*V)\r\n" +
+		"!\r\n"
+
+	sm, err := smartmeter.New(bytes.NewReader([]byte(telegram)), smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sm.Read()
+	var parseErr *smartmeter.ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 4 || parseErr.Code != "1-0:31.7.0" {
+		t.Fatalf("expected ParseError on line 4 in strict mode, got %v", err)
+	}
+
+	sm, err = smartmeter.New(bytes.NewReader([]byte(telegram)), smartmeter.Options{Mode: smartmeter.LenientMode})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet, err := sm.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(packet.Warnings) != 1 || packet.Warnings[0].Line != 4 || packet.Warnings[0].Code != "1-0:31.7.0" {
+		t.Errorf("expected a warning for line 4, got %+v", packet.Warnings)
+	}
+	if packet.Electricity.Tariffs[0].Consumed != 1 || packet.Electricity.Phases[0].InstantaneousVoltage != 230 {
+		t.Errorf("expected other lines to be parsed, got %+v", packet.Electricity)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		file string
+		// exact is set if the telegram only contains objects in the order and format in which the encoder writes them
+		exact bool
+		// changed contains the lines that are not written as-is
+		changed []string
+	}{
+		{file: "dsmr22.txt", exact: true},
+		{file: "esmr50.txt", exact: true},
+		{file: "esmr50_mbus.txt", exact: true},
+		// The history has summer time flags on winter timestamps, which are written with the flag of their time
+		{file: "emucs.txt", changed: []string{"0-0:98.1.0"}},
+		// The example telegram of DSMR 4.0 has a space in an OBIS code and a message that is wrapped over two lines
+		{file: "dsmr40.txt", changed: []string{"1 -3:0.2.8", "0-0:96.13.0", "3C3D3E3F"}},
+	}
+
+	for _, tt := range tests {
+		original, err := os.ReadFile(filepath.Join("test", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packet := testFile(t, tt.file)
+
+		var buf bytes.Buffer
+		encoder, err := smartmeter.NewEncoder(&buf, smartmeter.EncoderOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := encoder.Encode(packet); err != nil {
+			t.Fatal(err)
+		}
+		encoded := bytes.Clone(buf.Bytes())
+
+		if tt.exact && !bytes.Equal(encoded, original) {
+			t.Errorf("%s: expected encoded telegram to equal the original, got\n%s", tt.file, encoded)
+		}
+
+		// Every object must be written with its original code and precision
+		lines := strings.Split(string(encoded), "\r\n")
+	nextLine:
+		for _, line := range strings.Split(string(original), "\r\n") {
+			for _, prefix := range tt.changed {
+				if strings.HasPrefix(line, prefix) || strings.HasPrefix(prefix, line) {
+					continue nextLine
+				}
+			}
+			if strings.HasPrefix(line, "!") {
+				continue
+			}
+			if !slices.Contains(lines, line) {
+				t.Errorf("%s: expected line %q in encoded telegram\n%s", tt.file, line, encoded)
+			}
+		}
+
+		sm, err := smartmeter.New(&buf, smartmeter.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := sm.Read()
+		if err != nil {
+			t.Fatalf("%s: failed to parse encoded telegram: %v", tt.file, err)
+		}
+
+		// DSMR 2.2 telegrams have no timestamp, so the time at which they were parsed is used
+		if packet.DSMRVersion == "" && packet.EMUCSVersion == "" {
+			decoded.Timestamp = packet.Timestamp
+		}
+		decoded.Raw, packet.Raw = nil, nil
+
+		if !reflect.DeepEqual(decoded, packet) {
+			t.Errorf("%s: expected decoded packet\n%+v\nto equal the original packet\n%+v", tt.file, decoded, packet)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, version := range []smartmeter.Version{smartmeter.DSMR22, smartmeter.DSMR4, smartmeter.DSMR5} {
+		packet := testFile(t, "emucs.txt")
+		packet.Message = smartmeter.Message{Code: "01", Text: "Storing"}
+
+		var buf bytes.Buffer
+		encoder, err := smartmeter.NewEncoder(&buf, smartmeter.EncoderOptions{Version: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := encoder.Encode(packet); err != nil {
+			t.Fatal(err)
+		}
+
+		sm, err := smartmeter.New(&buf, smartmeter.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := sm.Read()
+		if err != nil {
+			t.Fatalf("%v: failed to parse encoded telegram: %v", version, err)
+		}
+
+		if decoded.Header != packet.Header {
+			t.Errorf("%v: expected header %+v, got %+v", version, packet.Header, decoded.Header)
+		}
+		if decoded.Electricity.Tariffs[1] != packet.Electricity.Tariffs[1] || decoded.Electricity.Threshold != packet.Electricity.Threshold {
+			t.Errorf("%v: expected electricity %+v, got %+v", version, packet.Electricity, decoded.Electricity)
+		}
+		if decoded.Gas.Consumed != packet.Gas.Consumed || decoded.Gas.EquipmentID != packet.Gas.EquipmentID || !decoded.Gas.MeasuredAt.Equal(packet.Gas.MeasuredAt) {
+			t.Errorf("%v: expected gas %+v, got %+v", version, packet.Gas, decoded.Gas)
+		}
+		if decoded.Message != packet.Message {
+			t.Errorf("%v: expected message %+v, got %+v", version, packet.Message, decoded.Message)
+		}
+
+		if version == smartmeter.DSMR22 {
+			continue
+		}
+
+		if !decoded.Timestamp.Equal(packet.Timestamp) {
+			t.Errorf("%v: expected timestamp %v, got %v", version, packet.Timestamp, decoded.Timestamp)
+		}
+		expected := packet.Electricity.CapacityTariff.MaximumDemandHistory[2]
+		if c := decoded.Electricity.CapacityTariff; c == nil || len(c.MaximumDemandHistory) != 3 || c.MaximumDemandHistory[2].Value != expected.Value || !c.MaximumDemandHistory[2].Month.Equal(expected.Month) || !c.MaximumDemandHistory[2].Timestamp.Equal(expected.Timestamp) {
+			t.Errorf("%v: expected capacity tariff %+v, got %+v", version, packet.Electricity.CapacityTariff, c)
+		}
+		if decoded.EMUCSVersion != packet.EMUCSVersion {
+			t.Errorf("%v: expected e-MUCS version %q, got %q", version, packet.EMUCSVersion, decoded.EMUCSVersion)
+		}
+		if decoded.Unknown["1-0:31.4.0"] != "(999*A)" {
+			t.Errorf("%v: expected unknown objects to be encoded, got %v", version, decoded.Unknown)
+		}
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	message := smartmeter.Message{Code: "1/2", Text: "Storing 1/2!\r\n/Bel (0800) 1234!"}
+
+	for version, expected := range map[smartmeter.Version]smartmeter.Message{
+		smartmeter.DSMR22: {Code: "12", Text: "Storing 12Bel 0800 1234"},
+		smartmeter.DSMR4:  message,
+		smartmeter.DSMR5:  message,
+	} {
+		packet := testFile(t, "esmr50.txt")
+		packet.Message = message
+
+		// The telegrams are written twice, so the first one has to end at its own ! line
+		var buf bytes.Buffer
+		encoder, err := smartmeter.NewEncoder(&buf, smartmeter.EncoderOptions{Version: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := encoder.Encode(packet); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		scanner := bufio.NewScanner(&buf)
+		scanner.Split(smartmeter.ScanTelegrams)
+
+		sm, err := smartmeter.New(nil, smartmeter.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var count int
+		for ; scanner.Scan(); count++ {
+			decoded, err := sm.Parse(scanner.Bytes())
+			if err != nil {
+				t.Fatalf("%v: failed to parse encoded telegram: %v", version, err)
+			}
+			if decoded.Message != expected {
+				t.Errorf("%v: expected message %+v, got %+v", version, expected, decoded.Message)
+			}
+		}
+		if count != 2 {
+			t.Errorf("%v: expected 2 telegrams, got %d", version, count)
+		}
+	}
+}
+
+func TestEncodeGas(t *testing.T) {
+	packet := &smartmeter.P1Packet{
+		DSMRVersion: "50",
+		Gas: smartmeter.Gas{
+			EquipmentID: "4730303032333430313233343536373839",
+			Consumed:    1234.567,
+			MeasuredAt:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+	}
+
+	var buf bytes.Buffer
+	encoder, err := smartmeter.NewEncoder(&buf, smartmeter.EncoderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encoder.Encode(packet); err != nil {
+		t.Fatal(err)
+	}
+
+	sm, err := smartmeter.New(&buf, smartmeter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := sm.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Gas.Consumed != packet.Gas.Consumed || decoded.Gas.EquipmentID != packet.Gas.EquipmentID || !decoded.Gas.MeasuredAt.Equal(packet.Gas.MeasuredAt) {
+		t.Errorf("expected gas %+v, got %+v", packet.Gas, decoded.Gas)
+	}
+}
+
+func testFile(t *testing.T, file string) *smartmeter.P1Packet {
 	f, err := os.Open(filepath.Join("test", file))
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer f.Close()
 
-	sm, err := smartmeter.New(f)
+	sm, err := smartmeter.New(f, smartmeter.Options{})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = sm.Read()
+	packet, err := sm.Read()
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	return packet
 }
@@ -0,0 +1,88 @@
+package smartmeter
+
+import (
+	"context"
+	"io"
+)
+
+// Result is a single result of Stream, containing either a packet or the error that occurred while reading it.
+type Result struct {
+	Packet *P1Packet
+	Err    error
+}
+
+// ReadContext reads the next packet like Read, but returns early when ctx is done. Since a blocked read cannot be
+// interrupted otherwise, the underlying reader is closed when ctx is done, after which the SmartMeter cannot be used
+// anymore.
+func (sm *SmartMeter) ReadContext(ctx context.Context) (*P1Packet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan Result, 1)
+	go func() {
+		packet, err := sm.Read()
+		done <- Result{Packet: packet, Err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.Packet, result.Err
+	case <-ctx.Done():
+		sm.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// Stream reads packets in the background until ctx is done or the reader returns an error that is not a ParseError
+// or ChecksumError. Every packet and error is sent on the returned channel, which is closed when the stream stops.
+// The underlying reader is closed when the stream stops.
+func (sm *SmartMeter) Stream(ctx context.Context) <-chan Result {
+	results := make(chan Result)
+
+	go func() {
+		defer close(results)
+		defer sm.Close()
+
+		for {
+			packet, err := sm.ReadContext(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
+			select {
+			case results <- Result{Packet: packet, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil && !IsRecoverable(err) {
+				return
+			}
+		}
+	}()
+
+	return results
+}
+
+// Close closes the underlying reader if it implements io.Closer. It is safe to call Close multiple times.
+func (sm *SmartMeter) Close() error {
+	var err error
+
+	sm.closeOnce.Do(func() {
+		if c, ok := sm.r.(io.Closer); ok {
+			err = c.Close()
+		}
+	})
+
+	return err
+}
+
+// IsRecoverable returns whether reading can continue after err, which is the case for errors in a single telegram.
+func IsRecoverable(err error) bool {
+	switch err.(type) {
+	case *ParseError, *ChecksumError:
+		return true
+	}
+	return false
+}